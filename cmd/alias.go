@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+// recordTypeAlias is shown as the type of host alias changes in plans.
+const recordTypeAlias = "ALIAS"
+
+// parseAliases parses "hostname=alias" pairs as accepted by --aliases and the
+// ALIASES environment variable.
+func parseAliases(pairs []string) (map[string][]string, error) {
+	aliases := make(map[string][]string)
+	for _, pair := range pairs {
+		hostname, alias, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || hostname == "" || alias == "" {
+			return nil, fmt.Errorf("invalid alias %q (expected hostname=alias)", pair)
+		}
+		aliases[hostname] = append(aliases[hostname], alias)
+	}
+	return aliases, nil
+}
+
+// splitAlias splits a configured alias into hostname and domain. Aliases
+// without a domain ("www") live in the domain of their host override.
+func splitAlias(alias, defaultDomain string) (string, string) {
+	if hostname, domain, ok := strings.Cut(alias, "."); ok {
+		return hostname, domain
+	}
+	return alias, defaultDomain
+}
+
+func aliasDescription(parent opnsense.RecordKey, owner string) string {
+	return ownership.Annotate(fmt.Sprintf("Alias of %s.%s", parent.Hostname, parent.Domain), owner)
+}
+
+// planAliases plans the aliases configured for each hostname. They are attached
+// to the A override of the hostname, or to the AAAA override when there is no
+// IPv4 address. Aliases owned by this agent that are no longer configured are
+// deleted. uuids holds the UUIDs of the host overrides when the ops are
+// applied.
+func planAliases(client *opnsense.Client, config *Config, hostnames []string, hostChanges []dnsChange, existing []opnsense.HostAlias, uuids map[opnsense.RecordKey]string) ([]plannedOp, error) {
+	var ops []plannedOp
+	wanted := make(map[opnsense.RecordKey]bool)
+
+	for _, hostname := range hostnames {
+		names := config.Aliases[hostname]
+		if len(names) == 0 {
+			continue
+		}
+
+		parent := primaryChange(hostChanges, hostname, config.Domain)
+		if parent == nil {
+			logger.Warn("No host override to attach aliases to", "hostname", hostname, "aliases", names)
+			continue
+		}
+		parentRecord := &opnsense.HostOverride{UUID: parent.UUID, Hostname: parent.Hostname, Domain: parent.Domain}
+		parentKey := opnsense.NewRecordKey(parent.Hostname, parent.Domain, parent.Type)
+
+		for _, name := range names {
+			aliasHostname, aliasDomain := splitAlias(name, config.Domain)
+			key := opnsense.NewRecordKey(aliasHostname, aliasDomain, recordTypeAlias)
+			wanted[key] = true
+
+			change := dnsChange{
+				Action:   actionCreate,
+				Hostname: aliasHostname,
+				Domain:   aliasDomain,
+				Type:     recordTypeAlias,
+				NewValue: parent.Hostname + "." + parent.Domain,
+			}
+
+			if parent.Action == actionSkip {
+				change.Action = actionSkip
+				change.Reason = parent.Reason
+				ops = append(ops, aliasOp(client, config, change, parentKey, uuids))
+				continue
+			}
+
+			current := findAlias(existing, aliasHostname, aliasDomain)
+			if current == nil {
+				ops = append(ops, aliasOp(client, config, change, parentKey, uuids))
+				continue
+			}
+
+			change.UUID = current.UUID
+			change.OldValue = change.NewValue
+			if tag, ok := ownership.Parse(current.Description); ok {
+				change.Owner = tag.Owner
+			}
+
+			switch {
+			case change.Owner != config.InstanceID && config.UnownedPolicy == ownership.PolicyFail:
+				return nil, fmt.Errorf("alias %s.%s (uuid %s) is not owned by this agent (owner %q)", aliasHostname, aliasDomain, current.UUID, change.Owner)
+			case change.Owner != config.InstanceID && config.UnownedPolicy == ownership.PolicySkip:
+				logger.Warn("Skipping host alias not owned by this agent", "hostname", aliasHostname, "domain", aliasDomain, "uuid", current.UUID, "owner", change.Owner)
+				change.Action = actionSkip
+				change.Reason = "not owned by this agent"
+			case change.Owner != config.InstanceID:
+				change.Action = actionUpdate
+				change.Reason = "adopt"
+			case !current.AttachedTo(parentRecord) || parent.UUID == "":
+				change.Action = actionUpdate
+				change.Reason = "host override changed"
+			case current.Description != aliasDescription(parentKey, config.InstanceID) || current.Enabled == "0":
+				change.Action = actionUpdate
+			default:
+				change.Action = actionNoop
+			}
+			ops = append(ops, aliasOp(client, config, change, parentKey, uuids))
+		}
+	}
+
+	for _, alias := range existing {
+		tag, ok := ownership.Parse(alias.Description)
+		if !ok || tag.Owner != config.InstanceID || wanted[opnsense.NewRecordKey(alias.Hostname, alias.Domain, recordTypeAlias)] {
+			continue
+		}
+		ops = append(ops, aliasOp(client, config, dnsChange{
+			Action:   actionDelete,
+			Hostname: alias.Hostname,
+			Domain:   alias.Domain,
+			Type:     recordTypeAlias,
+			UUID:     alias.UUID,
+			OldValue: alias.Host,
+			Owner:    tag.Owner,
+			Reason:   "no longer configured",
+		}, opnsense.RecordKey{}, uuids))
+	}
+
+	return ops, nil
+}
+
+// primaryChange returns the change of the override aliases of hostname in
+// domain are attached to.
+func primaryChange(changes []dnsChange, hostname, domain string) *dnsChange {
+	var primary *dnsChange
+	for i := range changes {
+		change := &changes[i]
+		if change.Hostname != hostname || change.Domain != domain {
+			continue
+		}
+		if change.Type == opnsense.RecordTypeA {
+			return change
+		}
+		if change.Type == opnsense.RecordTypeAAAA {
+			primary = change
+		}
+	}
+	return primary
+}
+
+func findAlias(aliases []opnsense.HostAlias, hostname, domain string) *opnsense.HostAlias {
+	for i := range aliases {
+		if strings.EqualFold(aliases[i].Hostname, hostname) && strings.EqualFold(aliases[i].Domain, domain) {
+			return &aliases[i]
+		}
+	}
+	return nil
+}
+
+func aliasesOf(record *opnsense.HostOverride, aliases []opnsense.HostAlias) []opnsense.HostAlias {
+	var attached []opnsense.HostAlias
+	for _, alias := range aliases {
+		if alias.AttachedTo(record) {
+			attached = append(attached, alias)
+		}
+	}
+	return attached
+}
+
+// aliasOp pairs an alias change with the call applying it, if there is
+// anything to apply. Deletions have no parent.
+func aliasOp(client *opnsense.Client, config *Config, change dnsChange, parent opnsense.RecordKey, uuids map[opnsense.RecordKey]string) plannedOp {
+	op := plannedOp{change: change}
+	switch change.Action {
+	case actionCreate, actionUpdate, actionDelete:
+		op.apply = func(ctx context.Context) error { return applyAliasChange(ctx, client, config, change, parent, uuids) }
+	}
+	return op
+}
+
+// applyAliasChange applies an alias change attached to the host override
+// parent. uuids holds the UUIDs of the host overrides written in this cycle,
+// so aliases can be attached to overrides created moments before.
+func applyAliasChange(ctx context.Context, client *opnsense.Client, config *Config, change dnsChange, parent opnsense.RecordKey, uuids map[opnsense.RecordKey]string) error {
+	alias := &opnsense.HostAlias{
+		UUID:     change.UUID,
+		Hostname: change.Hostname,
+		Domain:   change.Domain,
+		Enabled:  "1",
+	}
+
+	if change.Action == actionDelete {
+		return client.Unbound.DeleteHostAlias(ctx, alias)
+	}
+
+	alias.Host = uuids[parent]
+	if alias.Host == "" {
+		return fmt.Errorf("host override %s.%s has no UUID", parent.Hostname, parent.Domain)
+	}
+	alias.Description = aliasDescription(parent, config.InstanceID)
+
+	if change.Action == actionCreate {
+		return client.Unbound.CreateHostAlias(ctx, alias)
+	}
+	return client.Unbound.UpdateHostAlias(ctx, alias)
+}
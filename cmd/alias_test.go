@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"testing"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+func TestPlanAliases(t *testing.T) {
+	parentA := dnsChange{Action: actionNoop, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeA, UUID: "host-a"}
+	parentAAAA := dnsChange{Action: actionNoop, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeAAAA, UUID: "host-aaaa"}
+	ownedDescription := aliasDescription(opnsense.NewRecordKey("web", "home.lan", opnsense.RecordTypeA), "web1")
+
+	tests := []struct {
+		name       string
+		aliases    []string
+		parents    []dnsChange
+		existing   []opnsense.HostAlias
+		policy     string
+		want       map[string]string
+		wantReason string
+		wantErr    bool
+	}{
+		{
+			name:    "create",
+			aliases: []string{"www"},
+			parents: []dnsChange{parentAAAA, parentA},
+			want:    map[string]string{"www.home.lan": actionCreate},
+		},
+		{
+			name:    "host override in another domain",
+			aliases: []string{"www"},
+			parents: []dnsChange{{Action: actionNoop, Hostname: "web", Domain: "example.com", Type: opnsense.RecordTypeA, UUID: "other-a"}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "alias in another domain",
+			aliases: []string{"www.example.org"},
+			parents: []dnsChange{parentA},
+			want:    map[string]string{"www.example.org": actionCreate},
+		},
+		{
+			name:    "no host override",
+			aliases: []string{"www"},
+			want:    map[string]string{},
+		},
+		{
+			name:       "host override skipped",
+			aliases:    []string{"www"},
+			parents:    []dnsChange{{Action: actionSkip, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeA, UUID: "host-a", Reason: reasonIPv6Unknown}},
+			want:       map[string]string{"www.home.lan": actionSkip},
+			wantReason: reasonIPv6Unknown,
+		},
+		{
+			name:     "unchanged",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "1"}},
+			want:     map[string]string{"www.home.lan": actionNoop},
+		},
+		{
+			name:     "attached by display name",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "web.home.lan", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "1"}},
+			want:     map[string]string{"www.home.lan": actionNoop},
+		},
+		{
+			name:     "moved to another host override",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-other", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "1"}},
+			want:     map[string]string{"www.home.lan": actionUpdate},
+		},
+		{
+			name:     "host override created this cycle",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{{Action: actionCreate, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeA}},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "1"}},
+			want:     map[string]string{"www.home.lan": actionUpdate},
+		},
+		{
+			name:     "disabled",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "0"}},
+			want:     map[string]string{"www.home.lan": actionUpdate},
+		},
+		{
+			name:     "foreign adopted",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: "Website", Enabled: "1"}},
+			policy:   ownership.PolicyAdopt,
+			want:     map[string]string{"www.home.lan": actionUpdate},
+		},
+		{
+			name:     "foreign skipped",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: "Website", Enabled: "1"}},
+			policy:   ownership.PolicySkip,
+			want:     map[string]string{"www.home.lan": actionSkip},
+		},
+		{
+			name:     "foreign fails",
+			aliases:  []string{"www"},
+			parents:  []dnsChange{parentA},
+			existing: []opnsense.HostAlias{{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: "Website", Enabled: "1"}},
+			policy:   ownership.PolicyFail,
+			wantErr:  true,
+		},
+		{
+			name:    "unconfigured owned alias deleted",
+			parents: []dnsChange{parentA},
+			existing: []opnsense.HostAlias{
+				{UUID: "alias-1", Host: "host-a", Hostname: "www", Domain: "home.lan", Description: ownedDescription, Enabled: "1"},
+				{UUID: "alias-2", Host: "host-a", Hostname: "ftp", Domain: "home.lan", Description: "Files", Enabled: "1"},
+				{UUID: "alias-3", Host: "host-a", Hostname: "mail", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web2]", Enabled: "1"},
+			},
+			want: map[string]string{"www.home.lan": actionDelete},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Domain:        "home.lan",
+				InstanceID:    "web1",
+				UnownedPolicy: tt.policy,
+				Aliases:       map[string][]string{"web": tt.aliases},
+			}
+
+			ops, err := planAliases(nil, config, []string{"web"}, tt.parents, tt.existing, map[opnsense.RecordKey]string{})
+			changes := planOf(ops).Changes
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("planAliases planned %+v, want error", changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planAliases failed: %v", err)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("planAliases planned %d changes, want %d: %+v", len(changes), len(tt.want), changes)
+			}
+			for _, change := range changes {
+				name := change.Hostname + "." + change.Domain
+				if want, ok := tt.want[name]; !ok || change.Action != want {
+					t.Errorf("planAliases planned %s for %s, want %q", change.Action, name, want)
+				}
+				if tt.wantReason != "" && change.Reason != tt.wantReason {
+					t.Errorf("planAliases gave reason %q for %s, want %q", change.Reason, name, tt.wantReason)
+				}
+			}
+		})
+	}
+}
+
+func TestPrimaryChange(t *testing.T) {
+	a := dnsChange{Action: actionNoop, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeA, UUID: "host-a"}
+	aaaa := dnsChange{Action: actionNoop, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeAAAA, UUID: "host-aaaa"}
+	otherDomain := dnsChange{Action: actionNoop, Hostname: "web", Domain: "example.com", Type: opnsense.RecordTypeA, UUID: "other-a"}
+	mx := dnsChange{Action: actionNoop, Hostname: "web", Domain: "home.lan", Type: opnsense.RecordTypeMX, UUID: "host-mx"}
+
+	tests := []struct {
+		name    string
+		changes []dnsChange
+		want    string
+	}{
+		{name: "A record", changes: []dnsChange{aaaa, a}, want: "host-a"},
+		{name: "AAAA record without IPv4", changes: []dnsChange{aaaa, mx}, want: "host-aaaa"},
+		{name: "A record in another domain", changes: []dnsChange{otherDomain, aaaa}, want: "host-aaaa"},
+		{name: "no address record", changes: []dnsChange{otherDomain, mx}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if change := primaryChange(tt.changes, "web", "home.lan"); change != nil {
+				got = change.UUID
+			}
+			if got != tt.want {
+				t.Errorf("primaryChange = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
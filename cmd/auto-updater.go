@@ -1,41 +1,59 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
-	"opnsense-auto-dns/internal/api/opnsense"
 	"opnsense-auto-dns/internal/logger"
 )
 
-type Config struct {
-	OPNsenseHost      string   `json:"opnsense_host"`
-	OPNsenseAPIKey    string   `json:"opnsense_api_key"`
-	OPNsenseAPISecret string   `json:"opnsense_api_secret"`
-	Domain            string   `json:"domain"`
-	Hostnames         []string `json:"hostnames,omitempty"`
-	IPAddress         string   `json:"ip_address,omitempty"`
-}
-
 var (
 	configFile string
 	interval   int
 	loop       bool
+	watch      bool
+	dryRun     bool
 	ignoreCert bool
 
 	opnsenseHost      string
 	opnsenseAPIKey    string
 	opnsenseAPISecret string
+	caFile            string
+	serverName        string
+	certSHA256        []string
+	pubkeySHA256      []string
+	backend           string
+	retries           int
+	requestTimeout    int
+	timeout           int
 	domain            string
 	ipAddress         string
+	ipv6Address       string
+	disableIPv6       bool
 	hostnames         []string
+	aliasPairs        []string
+	iface             string
+	preferCIDR        []string
+	excludeCIDR       []string
+	ipSource          string
+	ipSourceURLs      []string
+	ipConsensus       int
+	stunServers       []string
+	deregisterOnExit  bool
+	instanceID        string
+	unownedPolicy     string
+	dhcpReservation   bool
+	firewallAlias     string
+	prune             bool
+	maxPrune          int
+	lease             int
 )
 
 var autoUpdaterCmd = &cobra.Command{
@@ -55,10 +73,61 @@ Configuration precedence (highest to lowest):
 IP address can be specified via config file (ip_address), environment variable (IP_ADDRESS),
 or command line flag (--ip-address). If not provided, the current machine's IP will be detected automatically.
 
+An AAAA record is maintained alongside the A record for each hostname when the machine has a
+global IPv6 address. The IPv6 address can be pinned with ipv6_address (IPV6_ADDRESS, --ipv6-address)
+and AAAA handling can be turned off with disable_ipv6 (DISABLE_IPV6, --disable-ipv6). Temporary (privacy)
+IPv6 addresses are not published when the interface has a stable one. When no IPv6 address is
+available or IPv6 is disabled, the AAAA records owned by the agent are deleted; when the IPv6 lookup
+fails, for example because an echo service timed out, they are left unchanged.
+
+On multi-homed machines the detected address can be restricted to a network interface
+(interface, INTERFACE, --interface) and/or to subnets (prefer_cidr/exclude_cidr, PREFER_CIDR/EXCLUDE_CIDR,
+--prefer-cidr/--exclude-cidr). When any of these are set and no IPv4 address matches, the update fails;
+when no IPv6 address matches, the AAAA records are skipped.
+
+The address is detected by an IP source (ip_source, IP_SOURCE, --ip-source):
+- local: the address of the route to the internet or the interface/CIDR selection above (default)
+- http:  the public address reported by "what is my IP" services (ip_source_urls), requiring
+         ip_consensus of them to agree (defaults to a majority)
+- stun:  the public address reported by a STUN binding request (stun_servers)
+The interface/CIDR selection only applies to the local source and is rejected with the others.
+
 Environment variables:
-- OPNSENSE_HOST, OPNSENSE_API_KEY, OPNSENSE_API_SECRET
-- HOSTNAMES (comma-separated list), DOMAIN, IP_ADDRESS
-- INTERVAL, LOOP, IGNORE_CERT
+- OPNSENSE_HOST, OPNSENSE_API_KEY, OPNSENSE_API_SECRET, BACKEND
+- CA_FILE, SERVER_NAME, CERT_SHA256, PUBKEY_SHA256 (comma-separated lists)
+- RETRIES, REQUEST_TIMEOUT, TIMEOUT (seconds)
+- HOSTNAMES (comma-separated list), ALIASES (comma-separated hostname=alias pairs), DOMAIN
+- IP_ADDRESS, IPV6_ADDRESS, DISABLE_IPV6
+- INTERFACE, PREFER_CIDR, EXCLUDE_CIDR (comma-separated lists)
+- IP_SOURCE, IP_SOURCE_URLS, IP_CONSENSUS, STUN_SERVERS (comma-separated lists)
+- INSTANCE_ID, UNOWNED_POLICY, LEASE, PRUNE, MAX_PRUNE, DHCP_RESERVATION, FIREWALL_ALIAS
+- INTERVAL, LOOP, WATCH, IGNORE_CERT, DEREGISTER_ON_EXIT
+
+In loop mode on Linux, --watch subscribes to netlink address events and updates DNS as soon as
+the watched interface (or any interface, if none is configured) gains or loses an address. The
+interval timer keeps running as a periodic reconciliation.
+
+In loop mode SIGINT/SIGTERM let an in-flight update finish before exiting (in-flight API calls are
+cancelled if it takes longer than 30 seconds or a second signal arrives), and SIGHUP reloads the
+config file, flags and environment without restarting. With deregister_on_exit (DEREGISTER_ON_EXIT,
+--deregister-on-exit) the A and AAAA records of the hostnames and the configured records are deleted
+when stopped with SIGTERM, together with the agent's DHCP reservation and firewall alias entries.
+
+With --dry-run the existing records are looked up and the planned create/update/no-op actions are
+printed (--output text or json) instead of being applied. The exit code is 0 when nothing would
+change, 2 when changes are pending and 1 on errors. The plan command does the same.
+
+Records created by this tool carry an ownership tag with the instance ID (instance_id, INSTANCE_ID,
+--instance-id, defaulting to the machine hostname) in their description. When a matching record
+exists that this agent does not own, unowned_policy (UNOWNED_POLICY, --unowned-policy) decides:
+adopt (take it over), skip (leave it alone, the default) or fail (abort the update).
+The tag also carries a heartbeat, which the sweep command uses to remove the records of agents that
+are gone. Unchanged records get their heartbeat refreshed once a quarter of lease (LEASE, --lease,
+in minutes, default 1440) has passed; set it to the lease the sweep runs with.
+
+With prune (PRUNE, --prune) records owned by this agent whose hostname is no longer configured are
+deleted. If more than max_prune (MAX_PRUNE, --max-prune, default 10) records would be deleted in
+one run, nothing is pruned.
 
 A config file can be specified using the --config flag, or configuration can be provided 
 via environment variables and command line flags.
@@ -66,6 +135,40 @@ via environment variables and command line flags.
 Hostnames can be specified as an array in config file or via --hostnames flag.
 If no hostnames are specified, the machine hostname will be used.
 
+Besides the A and AAAA records of the hostnames, further records such as MX and TXT can be listed
+under records in the config file (hostname, type, value and for MX priority; domain defaults to
+the configured domain). They are owned by the agent like its address records.
+
+Additional names can be published as Unbound host aliases of a hostname with aliases
+(ALIASES, --aliases server1=www). Aliases are attached to the A record of the hostname (or
+its AAAA record without IPv4) and are removed again when they are dropped from the config.
+
+The records are written to Unbound host overrides by default. On firewalls that use Dnsmasq for
+local names, set backend (BACKEND, --backend) to dnsmasq to write Dnsmasq host entries instead;
+this backend only supports A and AAAA records and no aliases.
+
+With dhcp_reservation (DHCP_RESERVATION, --dhcp-reservation) a Kea DHCPv4 reservation is kept for
+the MAC address of the machine and its current IPv4 address, named after the first hostname, so
+DNS and DHCP stay consistent. The MAC address is taken from interface, or from the interface that
+has the address assigned, and the reservation is placed in the Kea subnet containing the address.
+
+With firewall_alias (FIREWALL_ALIAS, --firewall-alias) the current addresses are kept in the named
+firewall host alias, so rules keyed on it follow the machine. The addresses the agent added are
+recorded in the alias description and removed once they are no longer current, or when the records
+are deleted with deregister_on_exit.
+
+opnsense_host (OPNSENSE_HOST, --opnsense-host) is the host name or address of the firewall,
+optionally with port, or a base URL with http or https scheme, port and path prefix, e.g.
+https://192.168.1.1:8443 for a web GUI on another port or http://proxy.lan/opnsense behind a
+reverse proxy. A bare host is reached over https.
+
+The certificate of the firewall is verified against the system CAs, or the CAs in ca_file
+(CA_FILE, --ca-file), for the host name or server_name (SERVER_NAME, --server-name). A self-signed
+certificate can instead be pinned with cert_sha256 (CERT_SHA256, --cert-sha256), the SHA-256
+fingerprint of the certificate, or pubkey_sha256 (PUBKEY_SHA256, --pubkey-sha256), the base64
+SHA-256 hash of its public key. When pins are set, connections to a certificate matching none of
+them are refused, also with --ignore-cert.
+
 Examples:
   # Run once with config file
   opnsense-auto-dns auto-updater --config config.json
@@ -73,6 +176,12 @@ Examples:
   # Run in continuous loop
   opnsense-auto-dns auto-updater --config config.json --loop --interval 10
 
+  # Update immediately on address changes, reconciling every 30 minutes
+  opnsense-auto-dns auto-updater --config config.json --loop --watch --interval 30
+
+  # Show what would change without touching the firewall
+  opnsense-auto-dns auto-updater --config config.json --dry-run
+
   # Use environment variables only
   opnsense-auto-dns auto-updater`,
 	Run: runAutoUpdater,
@@ -81,20 +190,61 @@ Examples:
 func init() {
 	rootCmd.AddCommand(autoUpdaterCmd)
 
-	autoUpdaterCmd.Flags().StringVar(&configFile, "config", "", "config file path")
 	autoUpdaterCmd.Flags().IntVar(&interval, "interval", 5, "update interval in minutes (when using --loop)")
 	autoUpdaterCmd.Flags().BoolVar(&loop, "loop", false, "run in continuous loop")
-	autoUpdaterCmd.Flags().BoolVar(&ignoreCert, "ignore-cert", false, "ignore certificate validation")
-
-	autoUpdaterCmd.Flags().StringVar(&opnsenseHost, "opnsense-host", "", "OPNsense host (overrides config file)")
-	autoUpdaterCmd.Flags().StringVar(&opnsenseAPIKey, "opnsense-api-key", "", "OPNsense API key (overrides config file)")
-	autoUpdaterCmd.Flags().StringVar(&opnsenseAPISecret, "opnsense-api-secret", "", "OPNsense API secret (overrides config file)")
-	autoUpdaterCmd.Flags().StringVar(&domain, "domain", "", "domain (overrides config file)")
-	autoUpdaterCmd.Flags().StringVar(&ipAddress, "ip-address", "", "IP address (overrides config file)")
-	autoUpdaterCmd.Flags().StringSliceVar(&hostnames, "hostnames", []string{}, "hostnames (overrides config file)")
+	autoUpdaterCmd.Flags().BoolVar(&watch, "watch", false, "update immediately on network address changes (Linux only, when using --loop)")
+	autoUpdaterCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the planned changes without applying them")
+	autoUpdaterCmd.Flags().BoolVar(&deregisterOnExit, "deregister-on-exit", false, "delete the DNS records when stopped with SIGTERM in loop mode (overrides config file)")
+	autoUpdaterCmd.Flags().StringVarP(&outputFormat, "output", "o", formatText, "plan output format for --dry-run (text, json)")
+	addUpdaterFlags(autoUpdaterCmd)
+}
+
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&configFile, "config", "", "config file path")
+	cmd.Flags().BoolVar(&ignoreCert, "ignore-cert", false, "ignore certificate validation")
+	cmd.Flags().StringVar(&opnsenseHost, "opnsense-host", "", "OPNsense host or base URL, e.g. https://192.168.1.1:8443/proxy (overrides config file)")
+	cmd.Flags().StringVar(&opnsenseAPIKey, "opnsense-api-key", "", "OPNsense API key (overrides config file)")
+	cmd.Flags().StringVar(&opnsenseAPISecret, "opnsense-api-secret", "", "OPNsense API secret (overrides config file)")
+	cmd.Flags().StringVar(&caFile, "ca-file", "", "PEM file of the CAs to verify the OPNsense certificate with (overrides config file)")
+	cmd.Flags().StringVar(&serverName, "server-name", "", "name to verify the OPNsense certificate against instead of the host (overrides config file)")
+	cmd.Flags().StringSliceVar(&certSHA256, "cert-sha256", []string{}, "accepted SHA-256 fingerprints of the OPNsense certificate in hex (overrides config file)")
+	cmd.Flags().StringSliceVar(&pubkeySHA256, "pubkey-sha256", []string{}, "accepted base64 SHA-256 hashes of the OPNsense certificate public key (overrides config file)")
+	cmd.Flags().IntVar(&retries, "retries", -1, "number of retries of API requests failing with transient errors, default 3 (overrides config file)")
+	cmd.Flags().IntVar(&requestTimeout, "request-timeout", 0, "timeout of a single API request in seconds, default 30 (overrides config file)")
+	cmd.Flags().IntVar(&timeout, "timeout", 0, "timeout of a whole run or update cycle in seconds, default 300 (overrides config file)")
+	cmd.Flags().StringVar(&instanceID, "instance-id", "", "ID recorded as owner of the managed records, defaults to the machine hostname (overrides config file)")
+}
+
+func addUpdaterFlags(cmd *cobra.Command) {
+	addConnectionFlags(cmd)
+
+	cmd.Flags().StringVar(&domain, "domain", "", "domain (overrides config file)")
+	cmd.Flags().StringVar(&backend, "backend", "", "DNS service to write the records to: unbound or dnsmasq (overrides config file)")
+	cmd.Flags().StringVar(&unownedPolicy, "unowned-policy", "", "what to do with matching records this agent does not own: adopt, skip or fail (overrides config file)")
+	cmd.Flags().BoolVar(&dhcpReservation, "dhcp-reservation", false, "keep a Kea DHCPv4 reservation for the MAC address and IPv4 address of this machine (overrides config file)")
+	cmd.Flags().StringVar(&firewallAlias, "firewall-alias", "", "firewall host alias to keep the current IP addresses in (overrides config file)")
+	cmd.Flags().IntVar(&lease, "lease", 0, "lease in minutes the records are swept after, the heartbeat is refreshed after a quarter of it, default 1440 (overrides config file)")
+	cmd.Flags().BoolVar(&prune, "prune", false, "delete records owned by this agent whose hostname is no longer configured (overrides config file)")
+	cmd.Flags().IntVar(&maxPrune, "max-prune", 0, "maximum number of records a single prune may delete, default 10 (overrides config file)")
+	cmd.Flags().StringVar(&ipAddress, "ip-address", "", "IP address (overrides config file)")
+	cmd.Flags().StringVar(&ipv6Address, "ipv6-address", "", "IPv6 address (overrides config file)")
+	cmd.Flags().BoolVar(&disableIPv6, "disable-ipv6", false, "do not manage AAAA records (overrides config file)")
+	cmd.Flags().StringSliceVar(&hostnames, "hostnames", []string{}, "hostnames (overrides config file)")
+	cmd.Flags().StringSliceVar(&aliasPairs, "aliases", []string{}, "host aliases as hostname=alias pairs (overrides config file)")
+	cmd.Flags().StringVar(&iface, "interface", "", "network interface to take the IP address from (overrides config file)")
+	cmd.Flags().StringSliceVar(&preferCIDR, "prefer-cidr", []string{}, "subnets the IP address must be in, in order of preference (overrides config file)")
+	cmd.Flags().StringSliceVar(&excludeCIDR, "exclude-cidr", []string{}, "subnets the IP address must not be in (overrides config file)")
+	cmd.Flags().StringVar(&ipSource, "ip-source", "", "IP source: local, http or stun (overrides config file)")
+	cmd.Flags().StringSliceVar(&ipSourceURLs, "ip-source-urls", []string{}, "IP echo service URLs for the http IP source (overrides config file)")
+	cmd.Flags().IntVar(&ipConsensus, "ip-consensus", 0, "number of IP echo services that must agree (overrides config file)")
+	cmd.Flags().StringSliceVar(&stunServers, "stun-servers", []string{}, "STUN servers for the stun IP source (overrides config file)")
 }
 
 func runAutoUpdater(cmd *cobra.Command, args []string) {
+	if dryRun {
+		preparePlanOutput()
+	}
+
 	if envInterval := os.Getenv("INTERVAL"); envInterval != "" {
 		if parsedInterval, err := strconv.Atoi(envInterval); err == nil {
 			interval = parsedInterval
@@ -113,109 +263,41 @@ func runAutoUpdater(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if envIgnoreCert := os.Getenv("IGNORE_CERT"); envIgnoreCert != "" {
-		if parsedIgnoreCert, err := strconv.ParseBool(envIgnoreCert); err == nil {
-			ignoreCert = parsedIgnoreCert
-			logger.Debug("Overriding ignore-cert from environment", "value", ignoreCert)
+	if envWatch := os.Getenv("WATCH"); envWatch != "" {
+		if parsedWatch, err := strconv.ParseBool(envWatch); err == nil {
+			watch = parsedWatch
+			logger.Debug("Overriding watch from environment", "value", watch)
 		} else {
-			logger.Warn("Invalid IGNORE_CERT environment variable", "value", envIgnoreCert, "err", err)
+			logger.Warn("Invalid WATCH environment variable", "value", envWatch, "err", err)
 		}
 	}
 
-	config := loadConfig()
-
-	if loop {
-		logger.Info("Starting auto-updater in loop mode", "interval", interval)
-		for {
-			updateDNS(config)
-			time.Sleep(time.Duration(interval) * time.Minute)
-		}
-	} else {
-		updateDNS(config)
+	if loop && interval <= 0 {
+		logger.Fatal("Invalid interval, it must be a positive number of minutes", "interval", interval)
 	}
-}
 
-func loadConfig() *Config {
-	var config Config
-
-	if configFile != "" {
-		data, err := os.ReadFile(configFile)
-		if err != nil {
-			logger.Fatal("Error reading config file", "path", configFile, "err", err)
-		}
-		logger.Debug("Using config file", "path", configFile)
-
-		if err := json.Unmarshal(data, &config); err != nil {
-			logger.Fatal("Error parsing config", "err", err)
-		}
-	} else {
-		logger.Debug("No config file provided, using environment variables and command line flags only")
+	config, err := loadUpdaterConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
 	}
 
-	if opnsenseHost != "" {
-		config.OPNsenseHost = opnsenseHost
-		logger.Debug("Overriding opnsense_host from command line", "value", opnsenseHost)
-	}
-	if opnsenseAPIKey != "" {
-		config.OPNsenseAPIKey = opnsenseAPIKey
-		logger.Debug("Overriding opnsense_api_key from command line")
-	}
-	if opnsenseAPISecret != "" {
-		config.OPNsenseAPISecret = opnsenseAPISecret
-		logger.Debug("Overriding opnsense_api_secret from command line")
-	}
-	if domain != "" {
-		config.Domain = domain
-		logger.Debug("Overriding domain from command line", "value", domain)
-	}
-	if ipAddress != "" {
-		config.IPAddress = ipAddress
-		logger.Debug("Overriding ip_address from command line", "value", ipAddress)
-	}
-	if len(hostnames) > 0 {
-		config.Hostnames = hostnames
-		logger.Debug("Overriding hostnames from command line", "hostnames", hostnames)
+	if dryRun {
+		if loop {
+			logger.Warn("--loop is ignored with --dry-run")
+		}
+		runPlan(config)
+		return
 	}
 
-	if envHost := os.Getenv("OPNSENSE_HOST"); envHost != "" {
-		config.OPNsenseHost = envHost
-		logger.Debug("Overriding opnsense_host from environment", "value", envHost)
-	}
-	if envAPIKey := os.Getenv("OPNSENSE_API_KEY"); envAPIKey != "" {
-		config.OPNsenseAPIKey = envAPIKey
-		logger.Debug("Overriding opnsense_api_key from environment")
-	}
-	if envAPISecret := os.Getenv("OPNSENSE_API_SECRET"); envAPISecret != "" {
-		config.OPNsenseAPISecret = envAPISecret
-		logger.Debug("Overriding opnsense_api_secret from environment")
-	}
-	if envDomain := os.Getenv("DOMAIN"); envDomain != "" {
-		config.Domain = envDomain
-		logger.Debug("Overriding domain from environment", "value", envDomain)
-	}
-	if envHostnames := os.Getenv("HOSTNAMES"); envHostnames != "" {
-		config.Hostnames = strings.Split(envHostnames, ",")
-		logger.Debug("Overriding hostnames from environment", "hostnames", config.Hostnames)
-	}
-	if envIPAddress := os.Getenv("IP_ADDRESS"); envIPAddress != "" {
-		config.IPAddress = envIPAddress
-		logger.Debug("Overriding ip_address from environment", "value", envIPAddress)
+	if loop {
+		runLoop(config)
+		return
 	}
 
-	if config.OPNsenseHost == "" {
-		logger.Fatal("opnsense_host is required")
-	}
-	if config.OPNsenseAPIKey == "" {
-		logger.Fatal("opnsense_api_key is required")
-	}
-	if config.OPNsenseAPISecret == "" {
-		logger.Fatal("opnsense_api_secret is required")
-	}
-	if config.Domain == "" {
-		logger.Fatal("domain is required")
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	return &config
+	updateDNS(ctx, config)
 }
 
 func getMachineHostname() (string, error) {
@@ -243,82 +325,22 @@ func getHostnamesToUse(config *Config) ([]string, error) {
 	return []string{hostname}, nil
 }
 
-func getCurrentIP(config *Config) (string, error) {
-	if config.IPAddress != "" {
-		logger.Debug("Using provided IP address", "ip", config.IPAddress)
-		return config.IPAddress, nil
-	}
-
-	conn, err := net.Dial("udp", "1.1.1.1:80")
-	if err != nil {
-		return "", fmt.Errorf("failed to create UDP connection: %v", err)
-	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	ip := localAddr.IP.String()
-
-	logger.Debug("Fetched local IP", "ip", ip)
-	return ip, nil
-}
-
-func updateDNS(config *Config) {
-	currentIP, err := getCurrentIP(config)
-	if err != nil {
-		logger.Error("Error getting current IP", "err", err)
-		return
-	}
-
-	hostnamesToUse, err := getHostnamesToUse(config)
-	if err != nil {
-		logger.Error("Error getting hostnames to use", "err", err)
-		return
-	}
+// updateDNS runs one update cycle and returns the addresses it published, nil
+// when they could not be determined.
+func updateDNS(ctx context.Context, config *Config) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
+	defer cancel()
 
-	logger.Info("Updating DNS records", "hostnames", hostnamesToUse, "ip", currentIP)
-
-	client := opnsense.NewClient(config.OPNsenseHost, config.OPNsenseAPIKey, config.OPNsenseAPISecret, ignoreCert)
-
-	for _, hostname := range hostnamesToUse {
-		if err := updateDNSForHostname(client, hostname, config.Domain, currentIP); err != nil {
-			logger.Error("Error updating DNS for hostname", "hostname", hostname, "err", err)
-		}
-	}
-}
+	client := newClient(config)
 
-func updateDNSForHostname(client *opnsense.Client, hostname, domain, currentIP string) error {
-	existingRecord, err := client.Unbound.GetExistingDNSRecord(hostname, domain)
+	plan, err := buildPlan(ctx, client, config)
 	if err != nil {
-		return fmt.Errorf("error getting existing DNS record: %v", err)
-	}
-
-	var oldIP string
-	if existingRecord != nil {
-		oldIP = existingRecord.Server
-		logger.Debug("Found existing DNS record", "hostname", hostname, "old_ip", oldIP, "uuid", existingRecord.UUID)
-	} else {
-		oldIP = "none"
-		logger.Debug("No existing DNS record found, will create new one", "hostname", hostname)
-	}
-
-	if oldIP == currentIP {
-		logger.Debug("IP unchanged, skipping update", "hostname", hostname, "ip", currentIP)
-		return nil
-	}
-
-	logger.Info("IP changed, updating DNS", "hostname", hostname, "old_ip", oldIP, "new_ip", currentIP)
-
-	if existingRecord != nil {
-		if err := client.Unbound.UpdateDNSRecord(existingRecord, hostname, domain, currentIP); err != nil {
-			return fmt.Errorf("error updating DNS record: %v", err)
-		}
-		logger.Info("Successfully updated DNS record", "hostname", hostname, "domain", domain, "ip", currentIP)
-	} else {
-		if err := client.Unbound.CreateDNSRecord(hostname, domain, currentIP); err != nil {
-			return fmt.Errorf("error creating DNS record: %v", err)
+		logger.Error("Error planning DNS updates", errorArgs(err)...)
+		if plan == nil {
+			return nil
 		}
-		logger.Info("Successfully created DNS record", "hostname", hostname, "domain", domain, "ip", currentIP)
 	}
 
-	return nil
+	applyPlan(ctx, client, config, plan)
+	return plan.addresses
 }
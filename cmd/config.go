@@ -0,0 +1,554 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"opnsense-auto-dns/internal/api"
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ipsource"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+	"opnsense-auto-dns/internal/recordfile"
+)
+
+const (
+	defaultAPIRetries     = 3
+	defaultRequestTimeout = 30
+	defaultTimeout        = 300
+)
+
+type Config struct {
+	OPNsenseHost      string              `json:"opnsense_host"`
+	OPNsenseAPIKey    string              `json:"opnsense_api_key"`
+	OPNsenseAPISecret string              `json:"opnsense_api_secret"`
+	CAFile            string              `json:"ca_file,omitempty"`
+	ServerName        string              `json:"server_name,omitempty"`
+	CertSHA256        []string            `json:"cert_sha256,omitempty"`
+	PubkeySHA256      []string            `json:"pubkey_sha256,omitempty"`
+	Backend           string              `json:"backend,omitempty"`
+	Retries           *int                `json:"retries,omitempty"`
+	RequestTimeout    int                 `json:"request_timeout,omitempty"`
+	Timeout           int                 `json:"timeout,omitempty"`
+	Domain            string              `json:"domain"`
+	Hostnames         []string            `json:"hostnames,omitempty"`
+	Aliases           map[string][]string `json:"aliases,omitempty"`
+	Records           []recordfile.Record `json:"records,omitempty"`
+	IPAddress         string              `json:"ip_address,omitempty"`
+	IPv6Address       string              `json:"ipv6_address,omitempty"`
+	DisableIPv6       bool                `json:"disable_ipv6,omitempty"`
+	Interface         string              `json:"interface,omitempty"`
+	PreferCIDR        []string            `json:"prefer_cidr,omitempty"`
+	ExcludeCIDR       []string            `json:"exclude_cidr,omitempty"`
+	IPSource          string              `json:"ip_source,omitempty"`
+	IPSourceURLs      []string            `json:"ip_source_urls,omitempty"`
+	IPConsensus       int                 `json:"ip_consensus,omitempty"`
+	STUNServers       []string            `json:"stun_servers,omitempty"`
+	DeregisterOnExit  bool                `json:"deregister_on_exit,omitempty"`
+	InstanceID        string              `json:"instance_id,omitempty"`
+	UnownedPolicy     string              `json:"unowned_policy,omitempty"`
+	Lease             int                 `json:"lease,omitempty"`
+	DHCPReservation   bool                `json:"dhcp_reservation,omitempty"`
+	FirewallAlias     string              `json:"firewall_alias,omitempty"`
+	Prune             bool                `json:"prune,omitempty"`
+	MaxPrune          int                 `json:"max_prune,omitempty"`
+
+	baseURL   string
+	tlsConfig *tls.Config
+	ipSource  ipsource.Source
+}
+
+func loadConfig() (*Config, error) {
+	var config Config
+
+	if envIgnoreCert := os.Getenv("IGNORE_CERT"); envIgnoreCert != "" {
+		if parsedIgnoreCert, err := strconv.ParseBool(envIgnoreCert); err == nil {
+			ignoreCert = parsedIgnoreCert
+			logger.Debug("Overriding ignore-cert from environment", "value", ignoreCert)
+		} else {
+			logger.Warn("Invalid IGNORE_CERT environment variable", "value", envIgnoreCert, "err", err)
+		}
+	}
+
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %v", configFile, err)
+		}
+		logger.Debug("Using config file", "path", configFile)
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("error parsing config: %v", err)
+		}
+	} else {
+		logger.Debug("No config file provided, using environment variables and command line flags only")
+	}
+
+	if opnsenseHost != "" {
+		config.OPNsenseHost = opnsenseHost
+		logger.Debug("Overriding opnsense_host from command line", "value", opnsenseHost)
+	}
+	if opnsenseAPIKey != "" {
+		config.OPNsenseAPIKey = opnsenseAPIKey
+		logger.Debug("Overriding opnsense_api_key from command line")
+	}
+	if opnsenseAPISecret != "" {
+		config.OPNsenseAPISecret = opnsenseAPISecret
+		logger.Debug("Overriding opnsense_api_secret from command line")
+	}
+	if caFile != "" {
+		config.CAFile = caFile
+		logger.Debug("Overriding ca_file from command line", "value", caFile)
+	}
+	if serverName != "" {
+		config.ServerName = serverName
+		logger.Debug("Overriding server_name from command line", "value", serverName)
+	}
+	if len(certSHA256) > 0 {
+		config.CertSHA256 = certSHA256
+		logger.Debug("Overriding cert_sha256 from command line", "value", certSHA256)
+	}
+	if len(pubkeySHA256) > 0 {
+		config.PubkeySHA256 = pubkeySHA256
+		logger.Debug("Overriding pubkey_sha256 from command line", "value", pubkeySHA256)
+	}
+	if retries >= 0 {
+		config.Retries = &retries
+		logger.Debug("Overriding retries from command line", "value", retries)
+	}
+	if requestTimeout > 0 {
+		config.RequestTimeout = requestTimeout
+		logger.Debug("Overriding request_timeout from command line", "value", requestTimeout)
+	}
+	if timeout > 0 {
+		config.Timeout = timeout
+		logger.Debug("Overriding timeout from command line", "value", timeout)
+	}
+	if backend != "" {
+		config.Backend = backend
+		logger.Debug("Overriding backend from command line", "value", backend)
+	}
+	if domain != "" {
+		config.Domain = domain
+		logger.Debug("Overriding domain from command line", "value", domain)
+	}
+	if ipAddress != "" {
+		config.IPAddress = ipAddress
+		logger.Debug("Overriding ip_address from command line", "value", ipAddress)
+	}
+	if ipv6Address != "" {
+		config.IPv6Address = ipv6Address
+		logger.Debug("Overriding ipv6_address from command line", "value", ipv6Address)
+	}
+	if disableIPv6 {
+		config.DisableIPv6 = true
+		logger.Debug("Overriding disable_ipv6 from command line", "value", disableIPv6)
+	}
+	if len(hostnames) > 0 {
+		config.Hostnames = hostnames
+		logger.Debug("Overriding hostnames from command line", "hostnames", hostnames)
+	}
+	if len(aliasPairs) > 0 {
+		parsedAliases, err := parseAliases(aliasPairs)
+		if err != nil {
+			return nil, err
+		}
+		config.Aliases = parsedAliases
+		logger.Debug("Overriding aliases from command line", "aliases", parsedAliases)
+	}
+	if iface != "" {
+		config.Interface = iface
+		logger.Debug("Overriding interface from command line", "value", iface)
+	}
+	if len(preferCIDR) > 0 {
+		config.PreferCIDR = preferCIDR
+		logger.Debug("Overriding prefer_cidr from command line", "value", preferCIDR)
+	}
+	if len(excludeCIDR) > 0 {
+		config.ExcludeCIDR = excludeCIDR
+		logger.Debug("Overriding exclude_cidr from command line", "value", excludeCIDR)
+	}
+	if ipSource != "" {
+		config.IPSource = ipSource
+		logger.Debug("Overriding ip_source from command line", "value", ipSource)
+	}
+	if len(ipSourceURLs) > 0 {
+		config.IPSourceURLs = ipSourceURLs
+		logger.Debug("Overriding ip_source_urls from command line", "value", ipSourceURLs)
+	}
+	if ipConsensus > 0 {
+		config.IPConsensus = ipConsensus
+		logger.Debug("Overriding ip_consensus from command line", "value", ipConsensus)
+	}
+	if len(stunServers) > 0 {
+		config.STUNServers = stunServers
+		logger.Debug("Overriding stun_servers from command line", "value", stunServers)
+	}
+	if instanceID != "" {
+		config.InstanceID = instanceID
+		logger.Debug("Overriding instance_id from command line", "value", instanceID)
+	}
+	if unownedPolicy != "" {
+		config.UnownedPolicy = unownedPolicy
+		logger.Debug("Overriding unowned_policy from command line", "value", unownedPolicy)
+	}
+	if lease > 0 {
+		config.Lease = lease
+		logger.Debug("Overriding lease from command line", "value", lease)
+	}
+	if dhcpReservation {
+		config.DHCPReservation = true
+		logger.Debug("Overriding dhcp_reservation from command line", "value", dhcpReservation)
+	}
+	if firewallAlias != "" {
+		config.FirewallAlias = firewallAlias
+		logger.Debug("Overriding firewall_alias from command line", "value", firewallAlias)
+	}
+	if prune {
+		config.Prune = true
+		logger.Debug("Overriding prune from command line", "value", prune)
+	}
+	if maxPrune > 0 {
+		config.MaxPrune = maxPrune
+		logger.Debug("Overriding max_prune from command line", "value", maxPrune)
+	}
+	if deregisterOnExit {
+		config.DeregisterOnExit = true
+		logger.Debug("Overriding deregister_on_exit from command line", "value", deregisterOnExit)
+	}
+
+	if envHost := os.Getenv("OPNSENSE_HOST"); envHost != "" {
+		config.OPNsenseHost = envHost
+		logger.Debug("Overriding opnsense_host from environment", "value", envHost)
+	}
+	if envAPIKey := os.Getenv("OPNSENSE_API_KEY"); envAPIKey != "" {
+		config.OPNsenseAPIKey = envAPIKey
+		logger.Debug("Overriding opnsense_api_key from environment")
+	}
+	if envAPISecret := os.Getenv("OPNSENSE_API_SECRET"); envAPISecret != "" {
+		config.OPNsenseAPISecret = envAPISecret
+		logger.Debug("Overriding opnsense_api_secret from environment")
+	}
+	if envCAFile := os.Getenv("CA_FILE"); envCAFile != "" {
+		config.CAFile = envCAFile
+		logger.Debug("Overriding ca_file from environment", "value", envCAFile)
+	}
+	if envServerName := os.Getenv("SERVER_NAME"); envServerName != "" {
+		config.ServerName = envServerName
+		logger.Debug("Overriding server_name from environment", "value", envServerName)
+	}
+	if envCertSHA256 := os.Getenv("CERT_SHA256"); envCertSHA256 != "" {
+		config.CertSHA256 = strings.Split(envCertSHA256, ",")
+		logger.Debug("Overriding cert_sha256 from environment", "value", config.CertSHA256)
+	}
+	if envPubkeySHA256 := os.Getenv("PUBKEY_SHA256"); envPubkeySHA256 != "" {
+		config.PubkeySHA256 = strings.Split(envPubkeySHA256, ",")
+		logger.Debug("Overriding pubkey_sha256 from environment", "value", config.PubkeySHA256)
+	}
+	if envRetries := os.Getenv("RETRIES"); envRetries != "" {
+		if parsedRetries, err := strconv.Atoi(envRetries); err == nil {
+			config.Retries = &parsedRetries
+			logger.Debug("Overriding retries from environment", "value", parsedRetries)
+		} else {
+			logger.Warn("Invalid RETRIES environment variable", "value", envRetries, "err", err)
+		}
+	}
+	if envRequestTimeout := os.Getenv("REQUEST_TIMEOUT"); envRequestTimeout != "" {
+		if parsedRequestTimeout, err := strconv.Atoi(envRequestTimeout); err == nil {
+			config.RequestTimeout = parsedRequestTimeout
+			logger.Debug("Overriding request_timeout from environment", "value", parsedRequestTimeout)
+		} else {
+			logger.Warn("Invalid REQUEST_TIMEOUT environment variable", "value", envRequestTimeout, "err", err)
+		}
+	}
+	if envTimeout := os.Getenv("TIMEOUT"); envTimeout != "" {
+		if parsedTimeout, err := strconv.Atoi(envTimeout); err == nil {
+			config.Timeout = parsedTimeout
+			logger.Debug("Overriding timeout from environment", "value", parsedTimeout)
+		} else {
+			logger.Warn("Invalid TIMEOUT environment variable", "value", envTimeout, "err", err)
+		}
+	}
+	if envBackend := os.Getenv("BACKEND"); envBackend != "" {
+		config.Backend = envBackend
+		logger.Debug("Overriding backend from environment", "value", envBackend)
+	}
+	if envDomain := os.Getenv("DOMAIN"); envDomain != "" {
+		config.Domain = envDomain
+		logger.Debug("Overriding domain from environment", "value", envDomain)
+	}
+	if envHostnames := os.Getenv("HOSTNAMES"); envHostnames != "" {
+		config.Hostnames = strings.Split(envHostnames, ",")
+		logger.Debug("Overriding hostnames from environment", "hostnames", config.Hostnames)
+	}
+	if envAliases := os.Getenv("ALIASES"); envAliases != "" {
+		parsedAliases, err := parseAliases(strings.Split(envAliases, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALIASES environment variable: %v", err)
+		}
+		config.Aliases = parsedAliases
+		logger.Debug("Overriding aliases from environment", "aliases", parsedAliases)
+	}
+	if envIPAddress := os.Getenv("IP_ADDRESS"); envIPAddress != "" {
+		config.IPAddress = envIPAddress
+		logger.Debug("Overriding ip_address from environment", "value", envIPAddress)
+	}
+	if envIPv6Address := os.Getenv("IPV6_ADDRESS"); envIPv6Address != "" {
+		config.IPv6Address = envIPv6Address
+		logger.Debug("Overriding ipv6_address from environment", "value", envIPv6Address)
+	}
+	if envDisableIPv6 := os.Getenv("DISABLE_IPV6"); envDisableIPv6 != "" {
+		if parsedDisableIPv6, err := strconv.ParseBool(envDisableIPv6); err == nil {
+			config.DisableIPv6 = parsedDisableIPv6
+			logger.Debug("Overriding disable_ipv6 from environment", "value", parsedDisableIPv6)
+		} else {
+			logger.Warn("Invalid DISABLE_IPV6 environment variable", "value", envDisableIPv6, "err", err)
+		}
+	}
+	if envInterface := os.Getenv("INTERFACE"); envInterface != "" {
+		config.Interface = envInterface
+		logger.Debug("Overriding interface from environment", "value", envInterface)
+	}
+	if envPreferCIDR := os.Getenv("PREFER_CIDR"); envPreferCIDR != "" {
+		config.PreferCIDR = strings.Split(envPreferCIDR, ",")
+		logger.Debug("Overriding prefer_cidr from environment", "value", config.PreferCIDR)
+	}
+	if envExcludeCIDR := os.Getenv("EXCLUDE_CIDR"); envExcludeCIDR != "" {
+		config.ExcludeCIDR = strings.Split(envExcludeCIDR, ",")
+		logger.Debug("Overriding exclude_cidr from environment", "value", config.ExcludeCIDR)
+	}
+	if envIPSource := os.Getenv("IP_SOURCE"); envIPSource != "" {
+		config.IPSource = envIPSource
+		logger.Debug("Overriding ip_source from environment", "value", envIPSource)
+	}
+	if envIPSourceURLs := os.Getenv("IP_SOURCE_URLS"); envIPSourceURLs != "" {
+		config.IPSourceURLs = strings.Split(envIPSourceURLs, ",")
+		logger.Debug("Overriding ip_source_urls from environment", "value", config.IPSourceURLs)
+	}
+	if envIPConsensus := os.Getenv("IP_CONSENSUS"); envIPConsensus != "" {
+		if parsedIPConsensus, err := strconv.Atoi(envIPConsensus); err == nil {
+			config.IPConsensus = parsedIPConsensus
+			logger.Debug("Overriding ip_consensus from environment", "value", parsedIPConsensus)
+		} else {
+			logger.Warn("Invalid IP_CONSENSUS environment variable", "value", envIPConsensus, "err", err)
+		}
+	}
+	if envSTUNServers := os.Getenv("STUN_SERVERS"); envSTUNServers != "" {
+		config.STUNServers = strings.Split(envSTUNServers, ",")
+		logger.Debug("Overriding stun_servers from environment", "value", config.STUNServers)
+	}
+	if envInstanceID := os.Getenv("INSTANCE_ID"); envInstanceID != "" {
+		config.InstanceID = envInstanceID
+		logger.Debug("Overriding instance_id from environment", "value", envInstanceID)
+	}
+	if envUnownedPolicy := os.Getenv("UNOWNED_POLICY"); envUnownedPolicy != "" {
+		config.UnownedPolicy = envUnownedPolicy
+		logger.Debug("Overriding unowned_policy from environment", "value", envUnownedPolicy)
+	}
+	if envLease := os.Getenv("LEASE"); envLease != "" {
+		if parsedLease, err := strconv.Atoi(envLease); err == nil {
+			config.Lease = parsedLease
+			logger.Debug("Overriding lease from environment", "value", parsedLease)
+		} else {
+			logger.Warn("Invalid LEASE environment variable", "value", envLease, "err", err)
+		}
+	}
+	if envDHCPReservation := os.Getenv("DHCP_RESERVATION"); envDHCPReservation != "" {
+		if parsedDHCPReservation, err := strconv.ParseBool(envDHCPReservation); err == nil {
+			config.DHCPReservation = parsedDHCPReservation
+			logger.Debug("Overriding dhcp_reservation from environment", "value", parsedDHCPReservation)
+		} else {
+			logger.Warn("Invalid DHCP_RESERVATION environment variable", "value", envDHCPReservation, "err", err)
+		}
+	}
+	if envFirewallAlias := os.Getenv("FIREWALL_ALIAS"); envFirewallAlias != "" {
+		config.FirewallAlias = envFirewallAlias
+		logger.Debug("Overriding firewall_alias from environment", "value", envFirewallAlias)
+	}
+	if envPrune := os.Getenv("PRUNE"); envPrune != "" {
+		if parsedPrune, err := strconv.ParseBool(envPrune); err == nil {
+			config.Prune = parsedPrune
+			logger.Debug("Overriding prune from environment", "value", parsedPrune)
+		} else {
+			logger.Warn("Invalid PRUNE environment variable", "value", envPrune, "err", err)
+		}
+	}
+	if envMaxPrune := os.Getenv("MAX_PRUNE"); envMaxPrune != "" {
+		if parsedMaxPrune, err := strconv.Atoi(envMaxPrune); err == nil {
+			config.MaxPrune = parsedMaxPrune
+			logger.Debug("Overriding max_prune from environment", "value", parsedMaxPrune)
+		} else {
+			logger.Warn("Invalid MAX_PRUNE environment variable", "value", envMaxPrune, "err", err)
+		}
+	}
+	if envDeregisterOnExit := os.Getenv("DEREGISTER_ON_EXIT"); envDeregisterOnExit != "" {
+		if parsedDeregisterOnExit, err := strconv.ParseBool(envDeregisterOnExit); err == nil {
+			config.DeregisterOnExit = parsedDeregisterOnExit
+			logger.Debug("Overriding deregister_on_exit from environment", "value", parsedDeregisterOnExit)
+		} else {
+			logger.Warn("Invalid DEREGISTER_ON_EXIT environment variable", "value", envDeregisterOnExit, "err", err)
+		}
+	}
+
+	if config.OPNsenseHost == "" {
+		return nil, fmt.Errorf("opnsense_host is required")
+	}
+	baseURL, err := api.ParseBaseURL(config.OPNsenseHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opnsense_host: %v", err)
+	}
+	config.baseURL = baseURL
+	if strings.HasPrefix(baseURL, "http://") {
+		logger.Warn("OPNsense API is accessed over plain HTTP, the API key and secret are sent unencrypted", "url", baseURL)
+	}
+	if config.OPNsenseAPIKey == "" {
+		return nil, fmt.Errorf("opnsense_api_key is required")
+	}
+	if config.OPNsenseAPISecret == "" {
+		return nil, fmt.Errorf("opnsense_api_secret is required")
+	}
+
+	tlsConfig, err := api.NewTLSConfig(api.TLSOptions{
+		IgnoreCert:   ignoreCert,
+		CAFile:       config.CAFile,
+		ServerName:   config.ServerName,
+		CertSHA256:   config.CertSHA256,
+		PubkeySHA256: config.PubkeySHA256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+	config.tlsConfig = tlsConfig
+
+	if config.Retries == nil {
+		defaultRetries := defaultAPIRetries
+		config.Retries = &defaultRetries
+	}
+	if *config.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = defaultRequestTimeout
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.Backend == "" {
+		config.Backend = opnsense.BackendUnbound
+	}
+	if config.Backend != opnsense.BackendUnbound && config.Backend != opnsense.BackendDnsmasq {
+		return nil, fmt.Errorf("invalid backend %q (expected %s or %s)", config.Backend, opnsense.BackendUnbound, opnsense.BackendDnsmasq)
+	}
+
+	if config.InstanceID == "" {
+		hostname, err := getMachineHostname()
+		if err != nil {
+			return nil, fmt.Errorf("instance_id is not set and %v", err)
+		}
+		config.InstanceID = hostname
+	}
+	if err := ownership.ValidateOwner(config.InstanceID); err != nil {
+		return nil, fmt.Errorf("invalid instance_id: %v", err)
+	}
+	if config.UnownedPolicy == "" {
+		config.UnownedPolicy = ownership.PolicySkip
+	}
+	if err := ownership.ValidatePolicy(config.UnownedPolicy); err != nil {
+		return nil, fmt.Errorf("invalid unowned_policy: %v", err)
+	}
+	if config.MaxPrune <= 0 {
+		config.MaxPrune = defaultMaxPrune
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaultLease
+	}
+
+	return &config, nil
+}
+
+func loadUpdaterConfig() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Domain == "" {
+		return nil, fmt.Errorf("domain is required")
+	}
+	if config.IPSource != "" && config.IPSource != ipsource.KindLocal && usesAddressSelection(config) {
+		return nil, fmt.Errorf("interface, prefer_cidr and exclude_cidr require the %s IP source, the %s source detects the public address", ipsource.KindLocal, config.IPSource)
+	}
+	if config.ipSource, err = newIPSource(config); err != nil {
+		return nil, fmt.Errorf("invalid IP source configuration: %v", err)
+	}
+	if config.DHCPReservation && config.IPSource != "" && config.IPSource != ipsource.KindLocal {
+		return nil, fmt.Errorf("dhcp_reservation requires the %s IP source, the %s source detects the public address", ipsource.KindLocal, config.IPSource)
+	}
+	if err := recordfile.Prepare(config.Records, config.Domain); err != nil {
+		return nil, fmt.Errorf("invalid records: %v", err)
+	}
+	if config.Backend == opnsense.BackendDnsmasq {
+		if len(config.Aliases) > 0 {
+			return nil, fmt.Errorf("aliases are not supported by the %s backend", config.Backend)
+		}
+		for _, record := range config.Records {
+			if record.Type != opnsense.RecordTypeA && record.Type != opnsense.RecordTypeAAAA {
+				return nil, fmt.Errorf("%s records are not supported by the %s backend", record.Type, config.Backend)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+func newClient(config *Config) *opnsense.Client {
+	return opnsense.NewClient(config.baseURL, config.OPNsenseAPIKey, config.OPNsenseAPISecret, api.Options{
+		TLS:     config.tlsConfig,
+		Retries: *config.Retries,
+		Timeout: time.Duration(config.RequestTimeout) * time.Second,
+	})
+}
+
+// commandContext returns the context of a single run: cancelled on SIGINT or
+// SIGTERM and after the overall timeout.
+func commandContext(config *Config) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// errorArgs appends err to the log arguments args, with a hint on what to
+// check for API errors that retrying does not fix.
+func errorArgs(err error, args ...any) []any {
+	args = append(args, "err", err)
+	if hint := apiErrorHint(err); hint != "" {
+		args = append(args, "hint", hint)
+	}
+	return args
+}
+
+func apiErrorHint(err error) string {
+	switch {
+	case errors.Is(err, opnsense.ErrUnauthorized):
+		return "check opnsense_api_key and opnsense_api_secret"
+	case errors.Is(err, opnsense.ErrForbidden):
+		return "the API user lacks the privileges for this page"
+	case errors.Is(err, opnsense.ErrNotFound):
+		return "check opnsense_host and that the plugin or service is installed"
+	case errors.Is(err, opnsense.ErrValidation):
+		return "the firewall rejected the values, see the field messages"
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+var (
+	deleteTypes []string
+	deleteForce bool
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete DNS records from OPNsense",
+	Long: `Delete removes the host overrides of the given hostnames in the configured domain, e.g.
+when a machine is decommissioned. By default both the A and AAAA records are removed. They are
+deleted from the configured backend (backend, BACKEND, --backend: unbound or dnsmasq).
+
+Only records owned by this agent (see instance_id) are deleted unless --force is given.
+
+With firewall_alias (FIREWALL_ALIAS, --firewall-alias) the addresses the agent added to the
+firewall alias are removed as well, unless records it still owns hold them. With dhcp_reservation
+(DHCP_RESERVATION) the Kea reservations owned by the agent are deleted under the same condition.
+
+Hostnames are taken from --hostnames, the config file or the HOSTNAMES environment variable,
+falling back to the machine hostname like the auto-updater does.
+
+Examples:
+  # Remove the records of two hosts
+  opnsense-auto-dns delete --config config.json --hostnames server1,server2
+
+  # Only remove the AAAA record of this machine
+  opnsense-auto-dns delete --config config.json --type AAAA`,
+	Run: runDelete,
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().StringVar(&domain, "domain", "", "domain (overrides config file)")
+	deleteCmd.Flags().StringVar(&backend, "backend", "", "DNS service to delete the records from: unbound or dnsmasq (overrides config file)")
+	deleteCmd.Flags().StringSliceVar(&hostnames, "hostnames", []string{}, "hostnames to delete (overrides config file)")
+	deleteCmd.Flags().StringSliceVar(&deleteTypes, "type", []string{opnsense.RecordTypeA, opnsense.RecordTypeAAAA}, "record types to delete (A, AAAA, MX, TXT)")
+	deleteCmd.Flags().BoolVar(&deleteForce, "force", false, "also delete records not owned by this agent")
+	deleteCmd.Flags().StringVar(&firewallAlias, "firewall-alias", "", "firewall host alias to remove the addresses of the deleted records from (overrides config file)")
+	addConnectionFlags(deleteCmd)
+}
+
+func runDelete(cmd *cobra.Command, args []string) {
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+	if config.Domain == "" {
+		logger.Fatal("domain is required")
+	}
+
+	types, err := parseRecordTypes(deleteTypes)
+	if err != nil {
+		logger.Fatal("Invalid record type", "err", err)
+	}
+
+	hostnamesToDelete, err := getHostnamesToUse(config)
+	if err != nil {
+		logger.Fatal("Error getting hostnames to delete", "err", err)
+	}
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	owner := config.InstanceID
+	if deleteForce {
+		owner = ""
+	}
+
+	deleted, err := deleteDNSRecords(ctx, client, config, recordKeys(hostnamesToDelete, config.Domain, types), owner)
+	if err != nil {
+		logger.Fatal("Error deleting DNS records", "deleted", deleted, "err", err)
+	}
+	if err := releaseFirewallAlias(ctx, client, config); err != nil {
+		logger.Fatal("Error removing addresses from firewall alias", "err", err)
+	}
+	if err := releaseReservation(ctx, client, config); err != nil {
+		logger.Fatal("Error deleting DHCP reservation", "err", err)
+	}
+
+	logger.Info("Deleted DNS records", "hostnames", hostnamesToDelete, "domain", config.Domain, "deleted", deleted)
+}
+
+func deregisterDNS(config *Config) {
+	hostnamesToDelete, err := getHostnamesToUse(config)
+	if err != nil {
+		logger.Error("Error getting hostnames to deregister", "err", err)
+		return
+	}
+
+	logger.Info("Deregistering DNS records", "hostnames", hostnamesToDelete, "domain", config.Domain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	client := newClient(config)
+
+	keys := recordKeys(hostnamesToDelete, config.Domain, []string{opnsense.RecordTypeA, opnsense.RecordTypeAAAA})
+	for _, record := range config.Records {
+		keys = append(keys, opnsense.NewRecordKey(record.Hostname, record.Domain, record.Type))
+	}
+
+	deleted, err := deleteDNSRecords(ctx, client, config, keys, config.InstanceID)
+	if err != nil {
+		logger.Error("Error deregistering DNS records", "deleted", deleted, "err", err)
+		return
+	}
+	if err := releaseFirewallAlias(ctx, client, config); err != nil {
+		logger.Error("Error removing addresses from firewall alias", "err", err)
+	}
+	if err := releaseReservation(ctx, client, config); err != nil {
+		logger.Error("Error deleting DHCP reservation", "err", err)
+	}
+
+	logger.Info("Deregistered DNS records", "deleted", deleted)
+}
+
+// recordKeys returns the keys of the records of hostnames in domain with the
+// given types.
+func recordKeys(hostnames []string, domain string, types []string) []opnsense.RecordKey {
+	var keys []opnsense.RecordKey
+	for _, hostname := range hostnames {
+		for _, rr := range types {
+			keys = append(keys, opnsense.NewRecordKey(hostname, domain, rr))
+		}
+	}
+	return keys
+}
+
+// deleteDNSRecords deletes the records with the given keys from the configured
+// backend, together with the aliases attached to them. When owner is set,
+// records not owned by it are left in place.
+func deleteDNSRecords(ctx context.Context, client *opnsense.Client, config *Config, keys []opnsense.RecordKey, owner string) (int, error) {
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := service.SearchHostOverrides(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("error getting existing DNS records: %w", err)
+	}
+	index := opnsense.NewHostOverrideIndex(records)
+
+	var aliases []opnsense.HostAlias
+	if config.Backend == opnsense.BackendUnbound {
+		aliases, err = client.Unbound.SearchHostAliases(ctx, "")
+		if err != nil {
+			return 0, fmt.Errorf("error getting existing host aliases: %w", err)
+		}
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		hostname, domain, rr := key.Hostname, key.Domain, key.Type
+
+		record := index.Get(hostname, domain, rr)
+		if record == nil {
+			logger.Debug("No DNS record to delete", "hostname", hostname, "domain", domain, "rr", rr)
+			continue
+		}
+		if record.MultiAddress() {
+			logger.Warn("Not deleting DNS record with several addresses", "hostname", hostname, "domain", domain, "rr", rr, "uuid", record.UUID, "value", record.Value())
+			continue
+		}
+		if owner != "" && !ownership.OwnedBy(record.Description, owner) {
+			logger.Warn("Not deleting DNS record owned by someone else", "hostname", hostname, "domain", domain, "rr", rr, "uuid", record.UUID, "description", record.Description)
+			continue
+		}
+
+		for _, alias := range aliasesOf(record, aliases) {
+			if err := client.Unbound.DeleteHostAlias(ctx, &alias); err != nil {
+				return deleted, reconfigureAfterChanges(ctx, service, deleted, fmt.Errorf("error deleting alias %s.%s of %s: %w", alias.Hostname, alias.Domain, hostname, err))
+			}
+			deleted++
+		}
+
+		if err := service.DeleteHostOverride(ctx, record); err != nil {
+			return deleted, reconfigureAfterChanges(ctx, service, deleted, fmt.Errorf("error deleting %s record for %s: %w", rr, hostname, err))
+		}
+		deleted++
+	}
+
+	return deleted, reconfigureAfterChanges(ctx, service, deleted, nil)
+}
+
+// ownedAddresses returns the addresses of the A and AAAA records tagged as
+// owned by this agent in the configured backend.
+func ownedAddresses(ctx context.Context, client *opnsense.Client, config *Config) ([]string, error) {
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		return nil, err
+	}
+	records, err := service.SearchHostOverrides(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting existing DNS records: %w", err)
+	}
+
+	var addresses []string
+	for _, record := range records {
+		rr := record.RecordType()
+		if (rr == opnsense.RecordTypeA || rr == opnsense.RecordTypeAAAA) && ownership.TaggedBy(record.Description, config.InstanceID) {
+			addresses = append(addresses, record.Value())
+		}
+	}
+	return addresses, nil
+}
+
+// parseRecordTypes normalizes the record types given with --type and rejects
+// the ones host overrides cannot hold, so a typo does not silently match
+// nothing.
+func parseRecordTypes(types []string) ([]string, error) {
+	parsed := make([]string, 0, len(types))
+	for _, rr := range types {
+		rr = strings.ToUpper(strings.TrimSpace(rr))
+		if !slices.Contains(opnsense.RecordTypes, rr) {
+			return nil, fmt.Errorf("unsupported record type %q (expected one of %s)", rr, strings.Join(opnsense.RecordTypes, ", "))
+		}
+		parsed = append(parsed, rr)
+	}
+	return parsed, nil
+}
+
+// reconfigureAfterChanges reconfigures the DNS service once after a batch of
+// changes, also when the batch stopped half-way with err.
+func reconfigureAfterChanges(ctx context.Context, service opnsense.RecordService, changed int, err error) error {
+	if changed == 0 {
+		return err
+	}
+	if reconfigureErr := service.ReconfigureService(ctx); reconfigureErr != nil {
+		return errors.Join(err, fmt.Errorf("DNS records changed but failed to reconfigure service: %v", reconfigureErr))
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRecordTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "defaults", types: []string{"A", "AAAA"}, want: []string{"A", "AAAA"}},
+		{name: "normalized", types: []string{" aaaa", "mx ", "Txt"}, want: []string{"AAAA", "MX", "TXT"}},
+		{name: "typo", types: []string{"A", "AAA"}, wantErr: true},
+		{name: "unsupported", types: []string{"CNAME"}, wantErr: true},
+		{name: "empty", types: []string{""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecordTypes(tt.types)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecordTypes(%q) error = %v, want error %v", tt.types, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseRecordTypes(%q) = %q, want %q", tt.types, got, tt.want)
+			}
+		})
+	}
+}
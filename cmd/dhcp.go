@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ipsource"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+// recordTypeReservation is shown as the type of Kea reservation changes in
+// plans.
+const recordTypeReservation = "DHCP"
+
+func reservationDescription(hostname, owner string) string {
+	return ownership.Annotate("DHCP reservation of "+hostname, owner)
+}
+
+// planReservation plans the Kea DHCPv4 reservation binding the MAC address of
+// the machine to its current IPv4 address. The MAC address is taken from the
+// configured interface, or from the interface that has the address assigned.
+func planReservation(ctx context.Context, client *opnsense.Client, config *Config, hostname, ip string) (*plannedOp, error) {
+	mac, err := ipsource.HardwareAddr(config.Interface, net.ParseIP(ip))
+	if err != nil {
+		return nil, fmt.Errorf("error detecting MAC address: %w", err)
+	}
+
+	subnets, err := client.Kea.SearchSubnets(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting DHCP subnets: %w", err)
+	}
+	var subnet *opnsense.KeaSubnet
+	for i := range subnets {
+		if subnets[i].Contains(net.ParseIP(ip)) {
+			subnet = &subnets[i]
+			break
+		}
+	}
+	if subnet == nil {
+		return nil, fmt.Errorf("no DHCP subnet contains %s", ip)
+	}
+
+	existing, err := client.Kea.SearchReservations(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting DHCP reservations: %w", err)
+	}
+
+	reservation := &opnsense.KeaReservation{
+		Subnet:      subnet.UUID,
+		IPAddress:   ip,
+		HWAddress:   mac.String(),
+		Hostname:    hostname,
+		Description: reservationDescription(hostname, config.InstanceID),
+	}
+	change := dnsChange{
+		Action:   actionCreate,
+		Hostname: hostname,
+		Domain:   config.Domain,
+		Type:     recordTypeReservation,
+		NewValue: reservation.IPAddress + " " + reservation.HWAddress,
+	}
+
+	var current *opnsense.KeaReservation
+	for i := range existing {
+		r := &existing[i]
+		if !r.InSubnet(subnet) {
+			continue
+		}
+		if strings.EqualFold(r.HWAddress, reservation.HWAddress) {
+			current = r
+			continue
+		}
+		if r.IPAddress == ip {
+			logger.Warn("DHCP address is reserved for another MAC address", "ip", ip, "mac", r.HWAddress, "uuid", r.UUID)
+			change.Action = actionSkip
+			change.Reason = "address reserved for " + r.HWAddress
+			return &plannedOp{change: change}, nil
+		}
+	}
+	if current == nil {
+		return &plannedOp{change: change, apply: func(ctx context.Context) error { return client.Kea.CreateReservation(ctx, reservation) }}, nil
+	}
+
+	reservation.UUID = current.UUID
+	change.UUID = current.UUID
+	change.OldValue = current.IPAddress + " " + current.HWAddress
+	if tag, ok := ownership.Parse(current.Description); ok {
+		change.Owner = tag.Owner
+	}
+
+	switch {
+	case change.Owner != config.InstanceID && config.UnownedPolicy == ownership.PolicyFail:
+		return nil, fmt.Errorf("DHCP reservation for %s (uuid %s) is %w (owner %q)", current.HWAddress, current.UUID, ownership.ErrNotOwned, change.Owner)
+	case change.Owner != config.InstanceID && config.UnownedPolicy == ownership.PolicySkip:
+		logger.Warn("Skipping DHCP reservation not owned by this agent", "mac", current.HWAddress, "uuid", current.UUID, "owner", change.Owner)
+		change.Action = actionSkip
+		change.Reason = "not owned by this agent"
+	case change.Owner != config.InstanceID:
+		change.Action = actionUpdate
+		change.Reason = "adopt"
+	case current.IPAddress != reservation.IPAddress || current.Hostname != reservation.Hostname || current.Description != reservation.Description:
+		change.Action = actionUpdate
+	default:
+		change.Action = actionNoop
+	}
+
+	op := &plannedOp{change: change}
+	if change.Action == actionUpdate {
+		op.apply = func(ctx context.Context) error { return client.Kea.UpdateReservation(ctx, reservation) }
+	}
+	return op, nil
+}
+
+// releaseReservation deletes the Kea reservations tagged as owned by this
+// agent whose address no record it owns holds any more, after its records
+// were deleted.
+func releaseReservation(ctx context.Context, client *opnsense.Client, config *Config) error {
+	if !config.DHCPReservation {
+		return nil
+	}
+
+	reservations, err := client.Kea.SearchReservations(ctx, "")
+	if err != nil {
+		return fmt.Errorf("error getting DHCP reservations: %w", err)
+	}
+	published, err := ownedAddresses(ctx, client, config)
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	for i := range reservations {
+		reservation := &reservations[i]
+		if !ownership.TaggedBy(reservation.Description, config.InstanceID) || containsAddress(published, reservation.IPAddress) {
+			continue
+		}
+		logger.Info("Deleting DHCP reservation", "hostname", reservation.Hostname, "ip", reservation.IPAddress, "mac", reservation.HWAddress, "uuid", reservation.UUID)
+		if err := client.Kea.DeleteReservation(ctx, reservation); err != nil {
+			return err
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return nil
+	}
+
+	if err := client.Kea.ReconfigureService(ctx); err != nil {
+		return fmt.Errorf("DHCP reservation deleted but failed to reconfigure service: %w", err)
+	}
+	return nil
+}
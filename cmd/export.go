@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/backup"
+	"opnsense-auto-dns/internal/logger"
+)
+
+var (
+	exportFile   string
+	exportFormat string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all Unbound host overrides and their aliases",
+	Long: `Export writes every Unbound host override, with the aliases attached to it, to a snapshot
+file that can be restored with the import command, e.g. before risky changes or to migrate the
+overrides to another firewall.
+
+The format is taken from --format or the extension of --file (.json, .yaml/.yml or .csv) and
+defaults to JSON. Without --file the snapshot is written to stdout.
+
+Examples:
+  # Snapshot as JSON
+  opnsense-auto-dns export --config config.json --file overrides.json
+
+  # Snapshot as CSV on stdout
+  opnsense-auto-dns export --config config.json --format csv`,
+	Run: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportFile, "file", "f", "", "file to write the snapshot to (default stdout)")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "snapshot format (json, yaml, csv)")
+	addConnectionFlags(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) {
+	format := snapshotFormat(exportFormat, exportFile)
+	if exportFile == "" {
+		logger.SetOutput(os.Stderr)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	records, err := client.Unbound.SearchHostOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error exporting host overrides", "err", err)
+	}
+	aliases, err := client.Unbound.SearchHostAliases(ctx, "")
+	if err != nil {
+		logger.Fatal("Error exporting host aliases", "err", err)
+	}
+
+	snapshot, orphans := backup.New(records, aliases)
+	for _, alias := range orphans {
+		logger.Warn("Skipping host alias with unknown parent override", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain, "host", alias.Host)
+	}
+
+	if err := writeSnapshot(exportFile, format, snapshot); err != nil {
+		logger.Fatal("Error writing snapshot", "err", err)
+	}
+
+	logger.Info("Exported host overrides", "host_overrides", len(records), "aliases", len(aliases)-len(orphans), "format", format, "file", exportFile)
+}
+
+func writeSnapshot(path, format string, snapshot backup.Snapshot) error {
+	if path == "" {
+		return backup.Encode(os.Stdout, format, snapshot)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := backup.Encode(f, format, snapshot); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func snapshotFormat(format, path string) string {
+	if format == "" {
+		format = backup.FormatFromPath(path)
+	}
+	if err := checkOutputFormat(format, backup.FormatJSON, backup.FormatYAML, backup.FormatCSV); err != nil {
+		logger.Fatal("Invalid snapshot format", "err", err)
+	}
+	return format
+}
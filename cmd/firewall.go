@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+// recordTypeFirewallAlias is shown as the type of firewall alias changes in
+// plans.
+const recordTypeFirewallAlias = "FIREWALL"
+
+// aliasWriteAttempts bounds how often a firewall alias write lost to another
+// agent writing the same alias is repeated.
+const aliasWriteAttempts = 3
+
+// aliasEntries are the entries of a firewall alias owner removes (stale) and
+// keeps (current).
+type aliasEntries struct {
+	owner          string
+	stale, current []string
+}
+
+// planFirewallAlias plans the content of the configured firewall host alias:
+// the current addresses are added and the addresses this agent added before
+// are removed once they are no longer current. The entries the agent added are
+// recorded in the description of the alias, so a stale address is removed in a
+// later cycle when the cycle that changed the record failed to update the
+// alias. Addresses changed in this cycle are removed as well, for aliases
+// written before the entries were recorded.
+func planFirewallAlias(ctx context.Context, client *opnsense.Client, config *Config, currentIPs map[string]string, hostChanges []dnsChange) (*plannedOp, error) {
+	alias, err := getHostAlias(ctx, client, config.FirewallAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := ownership.AliasEntries(alias.Description)[config.InstanceID]
+	current := currentValues(currentIPs)
+	for _, change := range hostChanges {
+		if change.Type != opnsense.RecordTypeA && change.Type != opnsense.RecordTypeAAAA {
+			continue
+		}
+		if change.Action == actionSkip && change.Reason == reasonIPv6Unknown && !containsAddress(current, change.OldValue) {
+			// The AAAA record is kept, so is its address.
+			current = append(current, change.OldValue)
+			continue
+		}
+		if (change.Action == actionUpdate && change.Reason != "adopt" || change.Action == actionDelete) && change.OldValue != "" {
+			stale = append(stale, change.OldValue)
+		}
+	}
+
+	entries := &aliasEntries{owner: config.InstanceID, stale: stale, current: current}
+	planned, err := planAliasContent(alias, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &plannedOp{change: aliasContentChange(alias, planned)}
+	if op.change.Action == actionUpdate {
+		op.apply = func(ctx context.Context) error { return applyFirewallAliasChange(ctx, client, alias.Name, entries) }
+	}
+	return op, nil
+}
+
+// planAliasContent returns alias with the stale entries added by the owner of
+// entries replaced by the current ones. Entries another agent recorded are
+// kept.
+func planAliasContent(alias *opnsense.FirewallAlias, entries *aliasEntries) (*opnsense.FirewallAlias, error) {
+	var others []string
+	for entryOwner, recorded := range ownership.AliasEntries(alias.Description) {
+		if entryOwner != entries.owner {
+			others = append(others, recorded...)
+		}
+	}
+
+	content := slices.DeleteFunc(slices.Clone(alias.Content), func(entry string) bool {
+		return containsAddress(entries.stale, entry) && !containsAddress(entries.current, entry) && !containsAddress(others, entry)
+	})
+	for _, ip := range entries.current {
+		if !containsAddress(content, ip) {
+			content = append(content, ip)
+		}
+	}
+	description, err := ownership.SetAliasEntries(alias.Description, entries.owner, entries.current)
+	if err != nil {
+		return nil, fmt.Errorf("firewall alias %q: %w", alias.Name, err)
+	}
+
+	return &opnsense.FirewallAlias{
+		UUID:        alias.UUID,
+		Name:        alias.Name,
+		Type:        alias.Type,
+		Description: description,
+		Content:     content,
+	}, nil
+}
+
+// aliasContentChange describes replacing alias with planned.
+func aliasContentChange(alias, planned *opnsense.FirewallAlias) dnsChange {
+	change := dnsChange{
+		Action:   actionNoop,
+		Hostname: alias.Name,
+		Type:     recordTypeFirewallAlias,
+		UUID:     alias.UUID,
+		OldValue: strings.Join(alias.Content, ","),
+		NewValue: strings.Join(planned.Content, ","),
+	}
+	if change.OldValue != change.NewValue || planned.Description != alias.Description {
+		change.Action = actionUpdate
+	}
+	return change
+}
+
+func getHostAlias(ctx context.Context, client *opnsense.Client, name string) (*opnsense.FirewallAlias, error) {
+	alias, err := client.FirewallAlias.GetAlias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if alias.Type != "host" {
+		return nil, fmt.Errorf("firewall alias %q is of type %q, expected host", alias.Name, alias.Type)
+	}
+	return alias, nil
+}
+
+// releaseFirewallAlias removes the entries this agent added to the configured
+// firewall alias that no record it owns in service holds any more, after its
+// records were deleted.
+func releaseFirewallAlias(ctx context.Context, client *opnsense.Client, config *Config) error {
+	if config.FirewallAlias == "" {
+		return nil
+	}
+
+	alias, err := getHostAlias(ctx, client, config.FirewallAlias)
+	if err != nil {
+		return err
+	}
+	tracked := ownership.AliasEntries(alias.Description)[config.InstanceID]
+	if len(tracked) == 0 {
+		return nil
+	}
+
+	published, err := ownedAddresses(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(slices.Clone(tracked), func(entry string) bool {
+		return !containsAddress(published, entry)
+	})
+
+	entries := &aliasEntries{owner: config.InstanceID, stale: tracked, current: kept}
+	planned, err := planAliasContent(alias, entries)
+	if err != nil {
+		return err
+	}
+	change := aliasContentChange(alias, planned)
+	if change.Action != actionUpdate {
+		return nil
+	}
+	logger.Info("Removing addresses from firewall alias", "name", alias.Name, "old", change.OldValue, "new", change.NewValue)
+	return applyFirewallAliasChange(ctx, client, alias.Name, entries)
+}
+
+func currentValues(currentIPs map[string]string) []string {
+	var values []string
+	for _, rr := range []string{opnsense.RecordTypeA, opnsense.RecordTypeAAAA} {
+		if ip, ok := currentIPs[rr]; ok {
+			values = append(values, ip)
+		}
+	}
+	return values
+}
+
+// containsAddress reports whether entries contains ip, comparing addresses
+// rather than their notation.
+func containsAddress(entries []string, ip string) bool {
+	parsed := net.ParseIP(ip)
+	return slices.ContainsFunc(entries, func(entry string) bool {
+		if parsed != nil {
+			return parsed.Equal(net.ParseIP(entry))
+		}
+		return entry == ip
+	})
+}
+
+// applyFirewallAliasChange writes entries to the firewall alias name. Several
+// agents may share the alias and OPNsense has no conditional writes, so the
+// alias is read and its content planned right before writing, keeping what
+// other agents wrote since the change was planned. The alias is read back
+// after writing, and the write is repeated when another agent's write
+// replaced it.
+func applyFirewallAliasChange(ctx context.Context, client *opnsense.Client, name string, entries *aliasEntries) error {
+	written := false
+	for attempt := 1; ; attempt++ {
+		alias, err := getHostAlias(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		planned, err := planAliasContent(alias, entries)
+		if err != nil {
+			return err
+		}
+		if aliasContentChange(alias, planned).Action != actionUpdate {
+			break
+		}
+		if written {
+			if attempt > aliasWriteAttempts {
+				return fmt.Errorf("firewall alias %q kept being changed by other agents, giving up after %d writes", name, aliasWriteAttempts)
+			}
+			logger.Warn("Firewall alias was changed concurrently, writing it again", "name", name, "content", strings.Join(alias.Content, ","), "attempt", attempt)
+		}
+
+		if err := client.FirewallAlias.SetAliasContent(ctx, planned); err != nil {
+			return err
+		}
+		written = true
+	}
+	if !written {
+		return nil
+	}
+
+	if err := client.FirewallAlias.Reconfigure(ctx); err != nil {
+		logger.Error("Firewall alias changed but failed to reconfigure", "name", name, "err", err)
+		return err
+	}
+	return nil
+}
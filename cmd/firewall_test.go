@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"opnsense-auto-dns/internal/api"
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+// fakeAliasServer serves a single firewall host alias through the alias API.
+// afterSet, when set, runs once after a write is stored, to let another agent
+// write in between.
+type fakeAliasServer struct {
+	mu          sync.Mutex
+	description string
+	content     []string
+	writes      int
+	afterSet    func(s *fakeAliasServer)
+}
+
+func (s *fakeAliasServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/firewall/alias/getAliasUUID/"):
+		json.NewEncoder(w).Encode(map[string]string{"uuid": "alias-uuid"})
+	case r.URL.Path == "/api/firewall/alias/getItem/alias-uuid":
+		content := make(map[string]any)
+		for _, entry := range s.content {
+			content[entry] = map[string]any{"value": entry, "selected": 1}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"alias": map[string]any{
+			"name":        "webservers",
+			"type":        map[string]any{"host": map[string]any{"value": "Host(s)", "selected": 1}},
+			"description": s.description,
+			"content":     content,
+		}})
+	case r.URL.Path == "/api/firewall/alias/setItem/alias-uuid":
+		var payload struct {
+			Alias struct {
+				Content     string `json:"content"`
+				Description string `json:"description"`
+			} `json:"alias"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		s.writes++
+		s.description = payload.Alias.Description
+		s.content = strings.Split(payload.Alias.Content, "\n")
+		if afterSet := s.afterSet; afterSet != nil {
+			s.afterSet = nil
+			afterSet(s)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"result": "saved"})
+	case r.URL.Path == "/api/firewall/alias/reconfigure":
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *fakeAliasServer) alias() *opnsense.FirewallAlias {
+	content := slices.Clone(s.content)
+	slices.Sort(content)
+	return &opnsense.FirewallAlias{UUID: "alias-uuid", Name: "webservers", Type: "host", Description: s.description, Content: content}
+}
+
+func TestApplyFirewallAliasChangeConcurrentOwners(t *testing.T) {
+	const initial = "Web servers [opnsense-auto-dns owner=web1 entries=192.0.2.1] [opnsense-auto-dns owner=web2 entries=192.0.2.2]"
+
+	web1 := &aliasEntries{owner: "web1", stale: []string{"192.0.2.1"}, current: []string{"192.0.2.11"}}
+	web2 := &aliasEntries{owner: "web2", stale: []string{"192.0.2.2"}, current: []string{"192.0.2.12"}}
+
+	tests := []struct {
+		name string
+		// interleave applies the changes; web1Planned is the alias web1
+		// planned from the initial alias.
+		interleave func(t *testing.T, client *opnsense.Client, server *fakeAliasServer, web1Planned *opnsense.FirewallAlias)
+		wantWrites int
+	}{
+		{
+			// Both agents plan from the same alias, then web1 writes before web2.
+			name: "planned together",
+			interleave: func(t *testing.T, client *opnsense.Client, server *fakeAliasServer, web1Planned *opnsense.FirewallAlias) {
+				mustApplyFirewallAliasChange(t, client, web1)
+				mustApplyFirewallAliasChange(t, client, web2)
+			},
+			wantWrites: 2,
+		},
+		{
+			// web1 writes its plan right after web2 wrote, dropping web2's
+			// entries, so web2 has to write again.
+			name: "written in between",
+			interleave: func(t *testing.T, client *opnsense.Client, server *fakeAliasServer, web1Planned *opnsense.FirewallAlias) {
+				server.afterSet = func(s *fakeAliasServer) {
+					s.writes++
+					s.description = web1Planned.Description
+					s.content = web1Planned.Content
+				}
+				mustApplyFirewallAliasChange(t, client, web2)
+			},
+			wantWrites: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeAliasServer{description: initial, content: []string{"192.0.2.1", "192.0.2.2", "198.51.100.1"}}
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+			client := opnsense.NewClient(httpServer.URL, "key", "secret", api.Options{})
+
+			web1Planned, err := planAliasContent(server.alias(), web1)
+			if err != nil {
+				t.Fatalf("planning web1 failed: %v", err)
+			}
+
+			tt.interleave(t, client, server, web1Planned)
+
+			got := server.alias()
+			if want := []string{"192.0.2.11", "192.0.2.12", "198.51.100.1"}; !slices.Equal(got.Content, want) {
+				t.Errorf("alias content = %v, want %v", got.Content, want)
+			}
+			entries := ownership.AliasEntries(got.Description)
+			if !slices.Equal(entries["web1"], []string{"192.0.2.11"}) || !slices.Equal(entries["web2"], []string{"192.0.2.12"}) {
+				t.Errorf("alias entries = %v, want web1 [192.0.2.11] and web2 [192.0.2.12]", entries)
+			}
+			if server.writes != tt.wantWrites {
+				t.Errorf("alias written %d times, want %d", server.writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func mustApplyFirewallAliasChange(t *testing.T, client *opnsense.Client, entries *aliasEntries) {
+	t.Helper()
+	if err := applyFirewallAliasChange(context.Background(), client, "webservers", entries); err != nil {
+		t.Fatalf("applyFirewallAliasChange failed: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+	"opnsense-auto-dns/internal/recordfile"
+)
+
+var (
+	forwardsFile   string
+	forwardsDelete bool
+	forwardsDryRun bool
+	forwardsOutput string
+)
+
+var forwardsCmd = &cobra.Command{
+	Use:   "forwards",
+	Short: "Reconcile Unbound domain overrides with a desired-state file",
+	Long: `Forwards reads a YAML or JSON file of domain overrides (query forwarding entries) and makes
+Unbound match it: queries for each domain are forwarded to the listed servers. Entries are matched
+by domain and server; missing ones are created and ones whose port, type, verify name, description
+or enabled state differ are updated. With --delete, entries previously written with the same
+instance ID that are no longer in the file are deleted. Unbound is reconfigured once at the end.
+
+Entries carry the same ownership tag as host overrides, and existing entries that are not owned
+by the instance ID are handled according to unowned_policy (adopt, skip or fail).
+
+Forwards file format (files ending in .json are read as JSON):
+
+  forwards:
+    - domain: corp.example.com
+      server: 10.1.0.53
+    - domain: corp.example.com  # one entry per server
+      server: 10.1.0.54
+      port: 5353
+    - domain: lab.example.com
+      server: 10.2.0.53
+      type: dot                 # forward (default) or dot (DNS over TLS)
+      port: 853
+      verify: dns.lab.example.com
+      enabled: false
+
+Exit codes with --dry-run:
+  0  no changes pending
+  1  error
+  2  changes pending
+
+Examples:
+  # Show what would change
+  opnsense-auto-dns forwards --config config.json --file forwards.yaml --dry-run
+
+  # Apply, deleting entries removed from the file
+  opnsense-auto-dns forwards --config config.json --file forwards.yaml --instance-id split-dns --delete`,
+	Run: runForwards,
+}
+
+func init() {
+	rootCmd.AddCommand(forwardsCmd)
+
+	forwardsCmd.Flags().StringVarP(&forwardsFile, "file", "f", "", "desired-state forwards file (YAML or JSON)")
+	forwardsCmd.Flags().BoolVar(&forwardsDelete, "delete", false, "delete entries owned by this instance that are not in the file")
+	forwardsCmd.Flags().BoolVar(&forwardsDryRun, "dry-run", false, "print the planned changes without applying them")
+	forwardsCmd.Flags().StringVarP(&forwardsOutput, "output", "o", formatText, "plan output format (text, json)")
+	forwardsCmd.Flags().StringVar(&unownedPolicy, "unowned-policy", "", "what to do with matching entries this instance does not own: adopt, skip or fail (overrides config file)")
+	forwardsCmd.MarkFlagRequired("file")
+	addConnectionFlags(forwardsCmd)
+}
+
+func runForwards(cmd *cobra.Command, args []string) {
+	if err := checkOutputFormat(forwardsOutput, formatText, formatJSON); err != nil {
+		logger.Fatal("Invalid output format", "err", err)
+	}
+	logger.SetOutput(os.Stderr)
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+
+	desired, err := recordfile.LoadForwards(forwardsFile)
+	if err != nil {
+		logger.Fatal("Error loading forwards file", "err", err)
+	}
+	logger.Info("Loaded desired domain overrides", "path", forwardsFile, "forwards", len(desired))
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	existing, err := client.Forwards.SearchDomainOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error getting existing domain overrides", "err", err)
+	}
+
+	ops, err := planForwards(client, config, desired, existing)
+	if err != nil {
+		logger.Fatal("Error planning domain overrides", "err", err)
+	}
+
+	plan := planOf(ops)
+	if err := printPlan(os.Stdout, plan, forwardsOutput); err != nil {
+		logger.Fatal("Error printing plan", "err", err)
+	}
+
+	if forwardsDryRun {
+		if plan.HasChanges() {
+			os.Exit(exitChangesPending)
+		}
+		return
+	}
+
+	applied, err := applyOps(ctx, client, ops)
+	if err != nil {
+		logger.Fatal("Error applying domain overrides", "applied", applied, "err", err)
+	}
+
+	logger.Info("Synced domain overrides", "applied", applied)
+}
+
+func planForwards(client *opnsense.Client, config *Config, desired []recordfile.Forward, existing []opnsense.DomainOverride) ([]plannedOp, error) {
+	var ops []plannedOp
+	wanted := make(map[*opnsense.DomainOverride]bool)
+
+	for _, d := range desired {
+		forward := &opnsense.DomainOverride{
+			Type:        d.Type,
+			Domain:      d.Domain,
+			Server:      d.Server,
+			Port:        d.PortValue(),
+			Verify:      d.Verify,
+			Description: ownership.Annotate(d.Description, config.InstanceID),
+			Enabled:     "0",
+		}
+		if d.IsEnabled() {
+			forward.Enabled = "1"
+		}
+
+		change := dnsChange{
+			Action:   actionCreate,
+			Domain:   d.Domain,
+			Type:     strings.ToUpper(d.Type),
+			NewValue: forward.Target(),
+		}
+		apply := func(ctx context.Context) error { return client.Forwards.CreateDomainOverride(ctx, forward) }
+
+		if current := findForward(existing, d.Domain, d.Server); current != nil {
+			wanted[current] = true
+			forward.UUID = current.UUID
+			change.UUID = current.UUID
+			change.OldValue = current.Target()
+			if tag, ok := ownership.Parse(current.Description); ok {
+				change.Owner = tag.Owner
+			}
+			apply = func(ctx context.Context) error { return client.Forwards.UpdateDomainOverride(ctx, forward) }
+			if current.ForwardType() != forward.ForwardType() {
+				// Forwards and DNS over TLS entries live behind separate
+				// endpoints, so changing the type means replacing the entry.
+				apply = func(ctx context.Context) error {
+					if err := client.Forwards.DeleteDomainOverride(ctx, current); err != nil {
+						return err
+					}
+					forward.UUID = ""
+					return client.Forwards.CreateDomainOverride(ctx, forward)
+				}
+			}
+
+			// Only entries tagged with this instance are owned; legacy
+			// descriptions were not written by a forwards file.
+			owned := ownership.TaggedBy(current.Description, config.InstanceID)
+			diff := forwardDiff(current, forward)
+			switch {
+			case !owned && config.UnownedPolicy == ownership.PolicyFail:
+				return nil, fmt.Errorf("domain override for %s to %s (uuid %s) is not owned by this instance (owner %q)", d.Domain, d.Server, current.UUID, change.Owner)
+			case !owned && config.UnownedPolicy == ownership.PolicySkip:
+				logger.Warn("Skipping domain override not owned by this instance", "domain", d.Domain, "server", d.Server, "uuid", current.UUID, "owner", change.Owner)
+				change.Action = actionSkip
+				change.Reason = "not owned by this instance"
+			case !owned:
+				change.Action = actionUpdate
+				change.Reason = "adopt"
+			case len(diff) == 0:
+				change.Action = actionNoop
+			default:
+				change.Action = actionUpdate
+				change.Reason = strings.Join(diff, ", ")
+			}
+		}
+
+		ops = append(ops, plannedOp{change: change, apply: apply})
+	}
+
+	if !forwardsDelete {
+		return ops, nil
+	}
+
+	for i := range existing {
+		current := &existing[i]
+		tag, ok := ownership.Parse(current.Description)
+		if !ok || tag.Owner != config.InstanceID || wanted[current] {
+			continue
+		}
+
+		ops = append(ops, plannedOp{
+			change: dnsChange{
+				Action:   actionDelete,
+				Domain:   current.Domain,
+				Type:     strings.ToUpper(current.ForwardType()),
+				UUID:     current.UUID,
+				OldValue: current.Target(),
+				Owner:    tag.Owner,
+				Reason:   "not in forwards file",
+			},
+			apply: func(ctx context.Context) error { return client.Forwards.DeleteDomainOverride(ctx, current) },
+		})
+	}
+
+	return ops, nil
+}
+
+func findForward(forwards []opnsense.DomainOverride, domain, server string) *opnsense.DomainOverride {
+	for i := range forwards {
+		if strings.EqualFold(strings.TrimSuffix(forwards[i].Domain, "."), domain) && forwards[i].Server == server {
+			return &forwards[i]
+		}
+	}
+	return nil
+}
+
+// forwardDiff returns the names of the fields in which existing differs from
+// the desired domain override.
+func forwardDiff(existing, desired *opnsense.DomainOverride) []string {
+	var diff []string
+	if existing.Port != desired.Port {
+		diff = append(diff, "port")
+	}
+	if existing.ForwardType() != desired.ForwardType() {
+		diff = append(diff, "type")
+	}
+	if existing.Verify != desired.Verify {
+		diff = append(diff, "verify")
+	}
+	if existing.Description != desired.Description {
+		diff = append(diff, "description")
+	}
+	if existing.Enabled != desired.Enabled {
+		diff = append(diff, "enabled")
+	}
+	return diff
+}
@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/backup"
+	"opnsense-auto-dns/internal/logger"
+)
+
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictFail      = "fail"
+)
+
+var (
+	importFile     string
+	importFormat   string
+	importConflict string
+	importDryRun   bool
+	importOutput   string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Restore host overrides and their aliases from a snapshot",
+	Long: `Import recreates the host overrides and aliases of a snapshot written by the export command.
+Overrides are matched to existing ones by UUID, then by hostname, domain, record type and value,
+then by hostname, domain and record type, each existing override at most once, so round-robin
+records sharing a name are restored side by side. Aliases are matched by UUID, then by hostname
+and domain, whichever override they are attached to. The plan is printed before it is applied and Unbound is
+reconfigured once at the end.
+
+When a matching entry exists but differs from the snapshot, --conflict decides:
+  skip       leave the existing entry alone (default)
+  overwrite  update the existing entry to match the snapshot
+  fail       abort before changing anything
+
+Examples:
+  # Show what a restore would do
+  opnsense-auto-dns import --config config.json --file overrides.json --dry-run
+
+  # Restore, overwriting entries changed since the snapshot
+  opnsense-auto-dns import --config config.json --file overrides.yaml --conflict overwrite`,
+	Run: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "snapshot file to import")
+	importCmd.Flags().StringVar(&importFormat, "format", "", "snapshot format (json, yaml, csv), defaults to the file extension")
+	importCmd.Flags().StringVar(&importConflict, "conflict", conflictSkip, "what to do with existing entries that differ: skip, overwrite or fail")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "print the planned changes without applying them")
+	importCmd.Flags().StringVarP(&importOutput, "output", "o", formatText, "plan output format (text, json)")
+	importCmd.MarkFlagRequired("file")
+	addConnectionFlags(importCmd)
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	if err := checkOutputFormat(importOutput, formatText, formatJSON); err != nil {
+		logger.Fatal("Invalid output format", "err", err)
+	}
+	if importConflict != conflictSkip && importConflict != conflictOverwrite && importConflict != conflictFail {
+		logger.Fatal("Invalid conflict mode", "conflict", importConflict, "expected", []string{conflictSkip, conflictOverwrite, conflictFail})
+	}
+	format := snapshotFormat(importFormat, importFile)
+	logger.SetOutput(os.Stderr)
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+
+	f, err := os.Open(importFile)
+	if err != nil {
+		logger.Fatal("Error opening snapshot file", "err", err)
+	}
+	snapshot, err := backup.Decode(f, format)
+	f.Close()
+	if err != nil {
+		logger.Fatal("Error reading snapshot", "path", importFile, "err", err)
+	}
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	records, err := client.Unbound.SearchHostOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error getting existing host overrides", "err", err)
+	}
+	aliases, err := client.Unbound.SearchHostAliases(ctx, "")
+	if err != nil {
+		logger.Fatal("Error getting existing host aliases", "err", err)
+	}
+
+	ops, err := planImport(client, snapshot, records, aliases)
+	if err != nil {
+		logger.Fatal("Error planning import", "err", err)
+	}
+
+	plan := planOf(ops)
+	if err := printPlan(os.Stdout, plan, importOutput); err != nil {
+		logger.Fatal("Error printing plan", "err", err)
+	}
+
+	if importDryRun {
+		if plan.HasChanges() {
+			os.Exit(exitChangesPending)
+		}
+		return
+	}
+
+	applied, err := applyOps(ctx, client, ops)
+	if err != nil {
+		logger.Fatal("Error importing snapshot", "applied", applied, "err", err)
+	}
+
+	logger.Info("Imported snapshot", "path", importFile, "applied", applied)
+}
+
+func planImport(client *opnsense.Client, snapshot backup.Snapshot, records []opnsense.HostOverride, aliases []opnsense.HostAlias) ([]plannedOp, error) {
+	matches := matchSnapshot(snapshot.HostOverrides, records)
+	aliasMatches := matchAliases(snapshot.HostOverrides, aliases)
+
+	var ops []plannedOp
+	for i, host := range snapshot.HostOverrides {
+		record := opnsense.NewDNSRecord(host.Hostname, host.Domain, host.Type, host.Value)
+		record.Description = host.Description
+		record.Enabled = enabledOrDefault(host.Enabled)
+
+		change := dnsChange{
+			Action:   actionCreate,
+			Hostname: host.Hostname,
+			Domain:   host.Domain,
+			Type:     host.Type,
+			NewValue: host.Value,
+		}
+		apply := func(ctx context.Context) error { return client.Unbound.CreateHostOverride(ctx, record) }
+
+		if existing := matches[i]; existing != nil {
+			record.UUID = existing.UUID
+			change.UUID = existing.UUID
+			change.OldValue = existing.Value()
+
+			resolveConflict(&change, syncDiff(existing, record))
+			apply = func(ctx context.Context) error { return client.Unbound.UpdateHostOverride(ctx, record) }
+		}
+		ops = append(ops, plannedOp{change: change, apply: apply})
+
+		for j, a := range host.Aliases {
+			ops = append(ops, planImportAlias(client, record, a, aliasMatches[i][j], records))
+		}
+	}
+
+	for _, op := range ops {
+		if op.change.Action == actionSkip && importConflict == conflictFail {
+			return nil, fmt.Errorf("existing %s %s (uuid %s) %s from the snapshot", op.change.Type, op.change.Name(), op.change.UUID, op.change.Reason)
+		}
+	}
+
+	return ops, nil
+}
+
+// matchSnapshot returns the existing override each snapshot host corresponds
+// to, nil where it has to be created. Hosts are matched by UUID, then by
+// hostname, domain, type and value, and only then by hostname, domain and type
+// alone, so every existing override is matched at most once and round-robin
+// records sharing a name are restored side by side.
+func matchSnapshot(hosts []backup.Host, records []opnsense.HostOverride) []*opnsense.HostOverride {
+	matches := make([]*opnsense.HostOverride, len(hosts))
+	used := make(map[string]bool, len(records))
+
+	match := func(same func(host backup.Host, record *opnsense.HostOverride) bool) {
+		for i, host := range hosts {
+			if matches[i] != nil {
+				continue
+			}
+			for j := range records {
+				record := &records[j]
+				if used[record.UUID] || !same(host, record) {
+					continue
+				}
+				matches[i] = record
+				used[record.UUID] = true
+				break
+			}
+		}
+	}
+	sameKey := func(host backup.Host, record *opnsense.HostOverride) bool {
+		return opnsense.NewRecordKey(host.Hostname, host.Domain, host.Type) == opnsense.NewRecordKey(record.Hostname, record.Domain, record.RecordType())
+	}
+
+	match(func(host backup.Host, record *opnsense.HostOverride) bool {
+		return host.UUID != "" && host.UUID == record.UUID
+	})
+	match(func(host backup.Host, record *opnsense.HostOverride) bool {
+		return sameKey(host, record) && record.EqualValue(host.Value)
+	})
+	match(sameKey)
+
+	return matches
+}
+
+// matchAliases returns the existing alias each alias of the snapshot hosts
+// corresponds to, nil where it has to be created. Like matchSnapshot, aliases
+// are matched by UUID first and then by hostname and domain, across all
+// parents, so an alias that moved to another override is updated rather than
+// duplicated.
+func matchAliases(hosts []backup.Host, aliases []opnsense.HostAlias) [][]*opnsense.HostAlias {
+	matches := make([][]*opnsense.HostAlias, len(hosts))
+	for i, host := range hosts {
+		matches[i] = make([]*opnsense.HostAlias, len(host.Aliases))
+	}
+	used := make(map[string]bool, len(aliases))
+
+	match := func(same func(a backup.Alias, alias *opnsense.HostAlias) bool) {
+		for i, host := range hosts {
+			for j, a := range host.Aliases {
+				if matches[i][j] != nil {
+					continue
+				}
+				for k := range aliases {
+					alias := &aliases[k]
+					if used[alias.UUID] || !same(a, alias) {
+						continue
+					}
+					matches[i][j] = alias
+					used[alias.UUID] = true
+					break
+				}
+			}
+		}
+	}
+
+	match(func(a backup.Alias, alias *opnsense.HostAlias) bool {
+		return a.UUID != "" && a.UUID == alias.UUID
+	})
+	match(func(a backup.Alias, alias *opnsense.HostAlias) bool {
+		return strings.EqualFold(a.Hostname, alias.Hostname) && strings.EqualFold(a.Domain, alias.Domain)
+	})
+
+	return matches
+}
+
+// planImportAlias plans restoring alias a under parent. existing is the alias
+// matchAliases found for it, and records are used to name its current parent.
+func planImportAlias(client *opnsense.Client, parent *opnsense.HostOverride, a backup.Alias, existing *opnsense.HostAlias, records []opnsense.HostOverride) plannedOp {
+	alias := &opnsense.HostAlias{
+		Hostname:    a.Hostname,
+		Domain:      a.Domain,
+		Description: a.Description,
+		Enabled:     enabledOrDefault(a.Enabled),
+	}
+
+	change := dnsChange{
+		Action:   actionCreate,
+		Hostname: a.Hostname,
+		Domain:   a.Domain,
+		Type:     recordTypeAlias,
+		NewValue: parent.Hostname + "." + parent.Domain,
+	}
+	apply := func(ctx context.Context) error {
+		if parent.UUID == "" {
+			return fmt.Errorf("parent override %s.%s was not created", parent.Hostname, parent.Domain)
+		}
+		alias.Host = parent.UUID
+		return client.Unbound.CreateHostAlias(ctx, alias)
+	}
+	if existing == nil {
+		return plannedOp{change: change, apply: apply}
+	}
+
+	alias.UUID = existing.UUID
+	change.UUID = existing.UUID
+	change.OldValue = existing.Host
+	for i := range records {
+		if existing.AttachedTo(&records[i]) {
+			change.OldValue = records[i].Hostname + "." + records[i].Domain
+			break
+		}
+	}
+
+	var diff []string
+	if parent.UUID == "" || !existing.AttachedTo(parent) {
+		diff = append(diff, "host")
+	}
+	if existing.Description != alias.Description {
+		diff = append(diff, "description")
+	}
+	if existing.Enabled != alias.Enabled {
+		diff = append(diff, "enabled")
+	}
+	resolveConflict(&change, diff)
+	apply = func(ctx context.Context) error {
+		if parent.UUID == "" {
+			return fmt.Errorf("parent override %s.%s was not created", parent.Hostname, parent.Domain)
+		}
+		alias.Host = parent.UUID
+		return client.Unbound.UpdateHostAlias(ctx, alias)
+	}
+
+	return plannedOp{change: change, apply: apply}
+}
+
+// resolveConflict sets the action of a change to an existing entry that
+// differs from the snapshot in the fields listed in diff. In fail mode the
+// change is marked skipped and planImport reports it before anything is
+// applied.
+func resolveConflict(change *dnsChange, diff []string) {
+	switch {
+	case len(diff) == 0:
+		change.Action = actionNoop
+	case importConflict == conflictOverwrite:
+		change.Action = actionUpdate
+		change.Reason = strings.Join(diff, ", ")
+	default:
+		change.Action = actionSkip
+		change.Reason = "differs: " + strings.Join(diff, ", ")
+	}
+}
+
+func enabledOrDefault(enabled string) string {
+	if enabled == "" {
+		return "1"
+	}
+	return enabled
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"testing"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/backup"
+)
+
+func TestMatchSnapshot(t *testing.T) {
+	records := []opnsense.HostOverride{
+		{UUID: "rr1", Hostname: "web", Domain: "home.lan", Server: "192.0.2.1"},
+		{UUID: "rr2", Hostname: "web", Domain: "home.lan", Server: "192.0.2.2"},
+		{UUID: "renamed", Hostname: "new", Domain: "home.lan", Server: "192.0.2.9"},
+		{UUID: "changed", Hostname: "db", Domain: "home.lan", Server: "192.0.2.5"},
+		{UUID: "mx", Hostname: "home.lan", Domain: "home.lan", RR: "MX", MXPrio: "10", MX: "mail.home.lan"},
+	}
+
+	tests := []struct {
+		name  string
+		hosts []backup.Host
+		want  []string
+	}{
+		{
+			name:  "UUID before name",
+			hosts: []backup.Host{{UUID: "renamed", Hostname: "old", Domain: "home.lan", Type: "A", Value: "192.0.2.9"}},
+			want:  []string{"renamed"},
+		},
+		{
+			name: "value before name",
+			hosts: []backup.Host{
+				{Hostname: "web", Domain: "home.lan", Type: "A", Value: "192.0.2.2"},
+				{Hostname: "web", Domain: "home.lan", Type: "A", Value: "192.0.2.1"},
+			},
+			want: []string{"rr2", "rr1"},
+		},
+		{
+			name: "name after value",
+			hosts: []backup.Host{
+				{Hostname: "WEB", Domain: "home.lan", Type: "A", Value: "192.0.2.3"},
+				{Hostname: "web", Domain: "home.lan", Type: "A", Value: "192.0.2.1"},
+			},
+			want: []string{"rr2", "rr1"},
+		},
+		{
+			name: "each record once",
+			hosts: []backup.Host{
+				{Hostname: "db", Domain: "home.lan", Type: "A", Value: "192.0.2.6"},
+				{Hostname: "db", Domain: "home.lan", Type: "A", Value: "192.0.2.7"},
+			},
+			want: []string{"changed", ""},
+		},
+		{
+			name: "UUID taken by an earlier host",
+			hosts: []backup.Host{
+				{UUID: "changed", Hostname: "db", Domain: "home.lan", Type: "A", Value: "192.0.2.6"},
+				{UUID: "changed", Hostname: "db", Domain: "home.lan", Type: "A", Value: "192.0.2.5"},
+			},
+			want: []string{"changed", ""},
+		},
+		{
+			name:  "type must match",
+			hosts: []backup.Host{{Hostname: "web", Domain: "home.lan", Type: "AAAA", Value: "2001:db8::1"}},
+			want:  []string{""},
+		},
+		{
+			name:  "MX by value",
+			hosts: []backup.Host{{Hostname: "home.lan", Domain: "home.lan", Type: "MX", Value: "10 mail.home.lan"}},
+			want:  []string{"mx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := matchSnapshot(tt.hosts, records)
+			for i, match := range matches {
+				got := ""
+				if match != nil {
+					got = match.UUID
+				}
+				if got != tt.want[i] {
+					t.Errorf("host %d matched %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchAliases(t *testing.T) {
+	aliases := []opnsense.HostAlias{
+		{UUID: "www", Host: "web", Hostname: "www", Domain: "home.lan"},
+		{UUID: "blog", Host: "other", Hostname: "blog", Domain: "home.lan"},
+		{UUID: "renamed", Host: "web", Hostname: "new", Domain: "home.lan"},
+	}
+
+	hosts := []backup.Host{
+		{Hostname: "web", Domain: "home.lan", Aliases: []backup.Alias{
+			{UUID: "renamed", Hostname: "old", Domain: "home.lan"},
+			{Hostname: "WWW", Domain: "Home.Lan"},
+		}},
+		{Hostname: "db", Domain: "home.lan", Aliases: []backup.Alias{
+			{Hostname: "blog", Domain: "home.lan"},
+			{Hostname: "www", Domain: "home.lan"},
+			{Hostname: "new", Domain: "home.lan"},
+		}},
+	}
+	want := [][]string{{"renamed", "www"}, {"blog", "", ""}}
+
+	matches := matchAliases(hosts, aliases)
+	for i := range hosts {
+		for j, match := range matches[i] {
+			got := ""
+			if match != nil {
+				got = match.UUID
+			}
+			if got != want[i][j] {
+				t.Errorf("alias %d of host %d matched %q, want %q", j, i, got, want[i][j])
+			}
+		}
+	}
+}
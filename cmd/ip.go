@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ipsource"
+	"opnsense-auto-dns/internal/logger"
+)
+
+func newIPSource(config *Config) (ipsource.Source, error) {
+	return ipsource.New(config.IPSource, ipsource.Options{
+		Interface:   config.Interface,
+		PreferCIDR:  config.PreferCIDR,
+		ExcludeCIDR: config.ExcludeCIDR,
+		URLs:        config.IPSourceURLs,
+		Consensus:   config.IPConsensus,
+		STUNServers: config.STUNServers,
+	})
+}
+
+// getCurrentIPs returns the current addresses by record type. noIPv6 reports
+// whether the machine is known to have no IPv6 address to publish, because
+// IPv6 is disabled or the IP source found none, as opposed to a lookup that
+// failed. Only then are the AAAA records withdrawn.
+func getCurrentIPs(ctx context.Context, config *Config) (currentIPs map[string]string, noIPv6 bool, err error) {
+	currentIPs = make(map[string]string)
+
+	currentIP, err := getCurrentIP(ctx, config, config.ipSource)
+	if err != nil && usesAddressSelection(config) && !errors.Is(err, ipsource.ErrFamilyNotSelected) {
+		// The host has an IPv4 address the selection is meant to find, so a
+		// miss fails the cycle instead of treating the host as IPv6-only.
+		return nil, false, fmt.Errorf("no IPv4 address matches the address selection: %v", err)
+	} else if err != nil {
+		logger.Error("Error getting current IP", "err", err)
+	} else {
+		currentIPs[opnsense.RecordTypeA] = currentIP
+	}
+
+	noIPv6 = config.DisableIPv6
+	if !config.DisableIPv6 {
+		currentIPv6, err := getCurrentIPv6(ctx, config, config.ipSource)
+		switch {
+		case err == nil:
+			currentIPs[opnsense.RecordTypeAAAA] = currentIPv6
+		case !errors.Is(err, ipsource.ErrNoAddress) && !errors.Is(err, ipsource.ErrFamilyNotSelected):
+			logger.Warn("Error getting current IPv6, leaving AAAA records unchanged", "err", err)
+		case usesAddressSelection(config):
+			noIPv6 = true
+			logger.Warn("No matching IPv6 address, skipping AAAA records", "err", err)
+		default:
+			noIPv6 = true
+			logger.Debug("No IPv6 address available, skipping AAAA records", "err", err)
+		}
+	}
+
+	if len(currentIPs) == 0 {
+		return nil, false, fmt.Errorf("no IP address available")
+	}
+
+	return currentIPs, noIPv6, nil
+}
+
+func getCurrentIP(ctx context.Context, config *Config, source ipsource.Source) (string, error) {
+	if config.IPAddress != "" {
+		if ip := net.ParseIP(config.IPAddress); ip == nil || ip.To4() == nil {
+			return "", fmt.Errorf("ip_address %q is not a valid IPv4 address", config.IPAddress)
+		}
+		logger.Debug("Using provided IP address", "ip", config.IPAddress)
+		return config.IPAddress, nil
+	}
+
+	ip, err := source.Lookup(ctx, ipsource.IPv4)
+	if err != nil {
+		return "", fmt.Errorf("%s IP source: %w", source.Name(), err)
+	}
+
+	logger.Debug("Fetched current IP", "source", source.Name(), "ip", ip)
+	return ip.String(), nil
+}
+
+func getCurrentIPv6(ctx context.Context, config *Config, source ipsource.Source) (string, error) {
+	if config.IPv6Address != "" {
+		if ip := net.ParseIP(config.IPv6Address); ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("ipv6_address %q is not a valid IPv6 address", config.IPv6Address)
+		}
+		logger.Debug("Using provided IPv6 address", "ip", config.IPv6Address)
+		return config.IPv6Address, nil
+	}
+
+	ip, err := source.Lookup(ctx, ipsource.IPv6)
+	if err != nil {
+		return "", fmt.Errorf("%s IP source: %w", source.Name(), err)
+	}
+
+	logger.Debug("Fetched current IPv6", "source", source.Name(), "ip", ip)
+	return ip.String(), nil
+}
+
+func usesAddressSelection(config *Config) bool {
+	return config.Interface != "" || len(config.PreferCIDR) > 0 || len(config.ExcludeCIDR) > 0
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+)
+
+var (
+	listDomain      string
+	listHostname    string
+	listDescription string
+	listOutput      string
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List DNS host overrides in OPNsense",
+	Long: `List prints the host overrides configured in OPNsense, optionally filtered by domain,
+hostname and description. The Unbound host overrides are listed by default, the Dnsmasq host
+entries with backend (BACKEND, --backend) set to dnsmasq.
+
+The --domain and --hostname filters are case-insensitive and accept shell-style patterns
+(e.g. "web*"). The --description filter matches any description containing the given text.
+
+Examples:
+  # All host overrides as a table
+  opnsense-auto-dns list --config config.json
+
+  # Overrides managed by this tool in one domain, as CSV
+  opnsense-auto-dns list --config config.json --domain home.local --description opnsense-auto-dns --output csv`,
+	Run: runList,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVar(&listDomain, "domain", "", "only list overrides in matching domains")
+	listCmd.Flags().StringVar(&listHostname, "hostname", "", "only list overrides with matching hostnames")
+	listCmd.Flags().StringVar(&listDescription, "description", "", "only list overrides whose description contains this text")
+	listCmd.Flags().StringVar(&backend, "backend", "", "DNS service to list the records of: unbound or dnsmasq (overrides config file)")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", formatTable, "output format (table, json, csv)")
+	addConnectionFlags(listCmd)
+}
+
+func runList(cmd *cobra.Command, args []string) {
+	if err := checkOutputFormat(listOutput, formatTable, formatJSON, formatCSV); err != nil {
+		logger.Fatal("Invalid output format", "err", err)
+	}
+	logger.SetOutput(os.Stderr)
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		logger.Fatal("Error listing host overrides", "err", err)
+	}
+	records, err := service.SearchHostOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error listing host overrides", "err", err)
+	}
+
+	filtered := []opnsense.HostOverride{}
+	for _, record := range records {
+		if matchesListFilters(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	logger.Debug("Filtered host overrides", "total", len(records), "matched", len(filtered))
+
+	if err := printHostOverrides(filtered, listOutput); err != nil {
+		logger.Fatal("Error printing host overrides", "err", err)
+	}
+}
+
+func matchesListFilters(record opnsense.HostOverride) bool {
+	if !matchesPattern(listDomain, record.Domain) || !matchesPattern(listHostname, record.Hostname) {
+		return false
+	}
+	if listDescription != "" && !strings.Contains(strings.ToLower(record.Description), strings.ToLower(listDescription)) {
+		return false
+	}
+	return true
+}
+
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && matched
+}
+
+func printHostOverrides(records []opnsense.HostOverride, format string) error {
+	if format == formatJSON {
+		return writeJSON(os.Stdout, records)
+	}
+
+	header := []string{"UUID", "HOSTNAME", "DOMAIN", "TYPE", "VALUE", "ENABLED", "DESCRIPTION"}
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, []string{record.UUID, record.Hostname, record.Domain, record.RecordType(), record.Value(), record.Enabled, record.Description})
+	}
+
+	if format == formatCSV {
+		for i := range header {
+			header[i] = strings.ToLower(header[i])
+		}
+		return writeCSV(os.Stdout, header, rows)
+	}
+	return writeTable(os.Stdout, header, rows)
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"maps"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/netwatch"
+)
+
+const (
+	watchSettleDelay = 2 * time.Second
+	shutdownTimeout  = 30 * time.Second
+)
+
+type loopTrigger int
+
+const (
+	triggerTimer loopTrigger = iota
+	triggerAddressChange
+	triggerReload
+	triggerShutdown
+)
+
+func runLoop(config *Config) {
+	logger.Info("Starting auto-updater in loop mode", "interval", interval, "watch", watch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	reload := make(chan struct{}, 1)
+	shutdown := make(chan struct{})
+	var shutdownSignal os.Signal
+	go handleSignals(signals, reload, shutdown, &shutdownSignal, cancel)
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	events := startWatch(watchCtx, config)
+
+	period := time.Duration(interval) * time.Minute
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	published := updateDNS(ctx, config)
+	for {
+		var trigger loopTrigger
+		trigger, events = waitForNextUpdate(ticker, events, reload, shutdown)
+
+		switch trigger {
+		case triggerShutdown:
+			stopWatch()
+			if config.DeregisterOnExit && shutdownSignal == syscall.SIGTERM {
+				deregisterDNS(config)
+			}
+			logger.Info("Auto-updater stopped")
+			return
+		case triggerReload:
+			newConfig, err := loadUpdaterConfig()
+			if err != nil {
+				logger.Error("Error reloading config, keeping previous configuration", "err", err)
+				break
+			}
+			if newConfig.Interface != config.Interface {
+				stopWatch()
+				watchCtx, stopWatch = context.WithCancel(ctx)
+				events = startWatch(watchCtx, newConfig)
+			}
+			config = newConfig
+			logger.Info("Reloaded configuration")
+		case triggerAddressChange:
+			if !addressesChanged(ctx, config, published) {
+				continue
+			}
+			logger.Info("Network address change detected, updating DNS")
+		}
+
+		if trigger != triggerTimer {
+			ticker.Reset(period)
+		}
+		published = updateDNS(ctx, config)
+	}
+}
+
+// addressesChanged looks up the current addresses after an address event and
+// reports whether they differ from the ones published last. Most events, such
+// as router advertisements refreshing SLAAC lifetimes, do not change them.
+func addressesChanged(ctx context.Context, config *Config, published map[string]string) bool {
+	if published == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	current, _, err := getCurrentIPs(ctx, config)
+	if err != nil || !maps.Equal(current, published) {
+		return true
+	}
+
+	logger.Debug("Addresses unchanged, skipping update", "addresses", current)
+	return false
+}
+
+func startWatch(ctx context.Context, config *Config) <-chan struct{} {
+	if !watch {
+		return nil
+	}
+
+	events, err := netwatch.Watch(ctx, config.Interface)
+	if err != nil {
+		logger.Warn("Address change notifications unavailable, relying on interval only", "err", err)
+		return nil
+	}
+
+	return events
+}
+
+// handleSignals records the first shutdown signal in shutdownSignal before
+// closing shutdown, so it can be read once shutdown is closed.
+func handleSignals(signals <-chan os.Signal, reload chan<- struct{}, shutdown chan<- struct{}, shutdownSignal *os.Signal, cancel context.CancelFunc) {
+	stopping := false
+	for sig := range signals {
+		switch {
+		case sig == syscall.SIGHUP:
+			logger.Info("Received SIGHUP, reloading configuration")
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		case !stopping:
+			stopping = true
+			*shutdownSignal = sig
+			logger.Info("Received signal, shutting down after in-flight update", "signal", sig, "timeout", shutdownTimeout)
+			close(shutdown)
+			time.AfterFunc(shutdownTimeout, func() {
+				logger.Warn("Shutdown timeout exceeded, cancelling in-flight API calls")
+				cancel()
+			})
+		default:
+			logger.Warn("Received second signal, cancelling in-flight API calls", "signal", sig)
+			cancel()
+		}
+	}
+}
+
+func waitForNextUpdate(ticker *time.Ticker, events <-chan struct{}, reload <-chan struct{}, shutdown <-chan struct{}) (loopTrigger, <-chan struct{}) {
+	for {
+		select {
+		case <-shutdown:
+			return triggerShutdown, events
+		case <-reload:
+			return triggerReload, events
+		case <-ticker.C:
+			logger.Debug("Running periodic reconciliation")
+			return triggerTimer, events
+		case _, ok := <-events:
+			if !ok {
+				logger.Warn("Address change notifications stopped, relying on interval only")
+				events = nil
+				continue
+			}
+			logger.Debug("Network address event received")
+			// Let the address settle (e.g. IPv6 DAD) and coalesce bursts of events.
+			select {
+			case <-shutdown:
+				return triggerShutdown, events
+			case <-time.After(watchSettleDelay):
+			}
+			select {
+			case <-events:
+			default:
+			}
+			return triggerAddressChange, events
+		}
+	}
+}
@@ -0,0 +1,611 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+const (
+	actionCreate  = "create"
+	actionUpdate  = "update"
+	actionNoop    = "no-op"
+	actionSkip    = "skip"
+	actionDelete  = "delete"
+	actionDisable = "disable"
+)
+
+const exitChangesPending = 2
+
+// reasonMultiAddress marks records holding several addresses, which the agent
+// leaves alone rather than reducing them to one.
+const reasonMultiAddress = "several addresses"
+
+// reasonIPv6Unknown marks AAAA records kept because the IPv6 lookup failed.
+const reasonIPv6Unknown = "IPv6 address unknown"
+
+// defaultLease is the lease in minutes heartbeats are refreshed against, the
+// default lease of the sweep command.
+const defaultLease = 24 * 60
+
+var outputFormat string
+
+type dnsChange struct {
+	Action   string `json:"action"`
+	Hostname string `json:"hostname"`
+	Domain   string `json:"domain"`
+	Type     string `json:"type"`
+	UUID     string `json:"uuid,omitempty"`
+	OldValue string `json:"old_value,omitempty"`
+	NewValue string `json:"new_value,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Name returns the name of the changed entry, the domain for domain overrides
+// and the alias name for firewall aliases.
+func (c dnsChange) Name() string {
+	switch {
+	case c.Hostname == "":
+		return c.Domain
+	case c.Domain == "":
+		return c.Hostname
+	}
+	return c.Hostname + "." + c.Domain
+}
+
+// plannedOp is a planned change together with the API call that applies it.
+// Calls that depend on an earlier op, like alias creations needing the UUID of
+// their parent, resolve it when applied. In auto-updater plans apply is nil
+// when there is nothing to apply, and refreshes the heartbeat of unchanged
+// records whose heartbeat is due.
+type plannedOp struct {
+	change dnsChange
+	apply  func(ctx context.Context) error
+}
+
+func planOf(ops []plannedOp) *dnsPlan {
+	plan := &dnsPlan{ops: ops}
+	for _, op := range ops {
+		plan.Changes = append(plan.Changes, op.change)
+	}
+	return plan
+}
+
+// applyOps applies the create, update and delete ops in order and reconfigures
+// Unbound once at the end, also when an op failed half-way.
+func applyOps(ctx context.Context, client *opnsense.Client, ops []plannedOp) (int, error) {
+	applied := 0
+	var applyErr error
+	for _, op := range ops {
+		switch op.change.Action {
+		case actionCreate, actionUpdate, actionDelete:
+		default:
+			continue
+		}
+		if applyErr = op.apply(ctx); applyErr != nil {
+			applyErr = fmt.Errorf("error applying %s of %s %s: %v", op.change.Action, op.change.Type, op.change.Name(), applyErr)
+			break
+		}
+		applied++
+	}
+
+	return applied, reconfigureAfterChanges(ctx, client.Unbound, applied, applyErr)
+}
+
+type dnsPlan struct {
+	Changes []dnsChange `json:"changes"`
+
+	// ops are the changes with the calls applying them.
+	ops []plannedOp
+	// addresses are the current addresses by record type the plan was
+	// built for.
+	addresses map[string]string
+}
+
+func (p *dnsPlan) count(action string) int {
+	n := 0
+	for _, change := range p.Changes {
+		if change.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *dnsPlan) HasChanges() bool {
+	return p.count(actionCreate)+p.count(actionUpdate)+p.count(actionDelete)+p.count(actionDisable) > 0
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the DNS changes the auto-updater would make",
+	Long: `Plan looks up the existing host overrides for the configured hostnames and prints
+the create, update and no-op actions the auto-updater would perform, without changing anything
+on the firewall. It accepts the same configuration as the auto-updater command.
+
+Exit codes:
+  0  no changes pending
+  1  error
+  2  changes pending
+
+Examples:
+  # Human readable plan
+  opnsense-auto-dns plan --config config.json
+
+  # Machine readable plan
+  opnsense-auto-dns plan --config config.json --output json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		preparePlanOutput()
+
+		config, err := loadUpdaterConfig()
+		if err != nil {
+			logger.Fatal("Error loading config", "err", err)
+		}
+		runPlan(config)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	planCmd.Flags().StringVarP(&outputFormat, "output", "o", formatText, "output format (text, json)")
+	addUpdaterFlags(planCmd)
+}
+
+// preparePlanOutput validates the plan output format and moves logging to
+// stderr, so stdout only carries the plan. It runs before the config is
+// loaded, which logs as well.
+func preparePlanOutput() {
+	if err := checkOutputFormat(outputFormat, formatText, formatJSON); err != nil {
+		logger.Fatal("Invalid output format", "err", err)
+	}
+	logger.SetOutput(os.Stderr)
+}
+
+func runPlan(config *Config) {
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	plan, err := buildPlan(ctx, client, config)
+	if err != nil {
+		logger.Error("Error planning DNS updates", errorArgs(err)...)
+		if plan == nil {
+			os.Exit(1)
+		}
+	}
+
+	if printErr := printPlan(os.Stdout, plan, outputFormat); printErr != nil {
+		logger.Fatal("Error printing plan", "err", printErr)
+	}
+
+	switch {
+	case err != nil:
+		os.Exit(1)
+	case plan.HasChanges():
+		os.Exit(exitChangesPending)
+	}
+}
+
+func buildPlan(ctx context.Context, client *opnsense.Client, config *Config) (*dnsPlan, error) {
+	currentIPs, noIPv6, err := getCurrentIPs(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	hostnamesToUse, err := getHostnamesToUse(config)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hostnames to use: %w", err)
+	}
+
+	logger.Info("Planning DNS records", "hostnames", hostnamesToUse, "ip", currentIPs[opnsense.RecordTypeA], "ipv6", currentIPs[opnsense.RecordTypeAAAA])
+
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		return nil, err
+	}
+	records, err := service.SearchHostOverrides(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting existing DNS records: %w", err)
+	}
+	index := opnsense.NewHostOverrideIndex(records)
+
+	// uuids collects the UUIDs of the host overrides, including the ones
+	// created when the plan is applied, for the aliases attached to them.
+	uuids := make(map[opnsense.RecordKey]string)
+	var ops []plannedOp
+	for _, hostname := range hostnamesToUse {
+		for _, rr := range []string{opnsense.RecordTypeA, opnsense.RecordTypeAAAA} {
+			existing := index.Get(hostname, config.Domain, rr)
+			ip, ok := currentIPs[rr]
+			if !ok {
+				if change, ok := planWithdrawIPv6(config, hostname, rr, noIPv6, existing); ok {
+					ops = append(ops, recordOp(service, config, change, existing, uuids))
+				}
+				continue
+			}
+			change, err := planChange(config, hostname, config.Domain, rr, ip, existing)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, recordOp(service, config, change, existing, uuids))
+		}
+	}
+
+	for _, record := range config.Records {
+		existing := index.Get(record.Hostname, record.Domain, record.Type)
+		change, err := planChange(config, record.Hostname, record.Domain, record.Type, record.RecordValue(), existing)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, recordOp(service, config, change, existing, uuids))
+	}
+
+	var aliases []opnsense.HostAlias
+	if config.Backend == opnsense.BackendUnbound {
+		aliases, err = client.Unbound.SearchHostAliases(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("error getting existing host aliases: %w", err)
+		}
+		aliasOps, err := planAliases(client, config, hostnamesToUse, planOf(ops).Changes, aliases, uuids)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, aliasOps...)
+	}
+
+	if ip, ok := currentIPs[opnsense.RecordTypeA]; ok && config.DHCPReservation {
+		op, err := planReservation(ctx, client, config, hostnamesToUse[0], ip)
+		if errors.Is(err, ownership.ErrNotOwned) {
+			return nil, err
+		} else if err != nil {
+			logger.Error("Error planning DHCP reservation, skipping it", errorArgs(err, "hostname", hostnamesToUse[0])...)
+			op = &plannedOp{change: dnsChange{
+				Action:   actionSkip,
+				Hostname: hostnamesToUse[0],
+				Domain:   config.Domain,
+				Type:     recordTypeReservation,
+				NewValue: ip,
+				Reason:   err.Error(),
+			}}
+		}
+		ops = append(ops, *op)
+	}
+
+	if config.FirewallAlias != "" {
+		op, err := planFirewallAlias(ctx, client, config, currentIPs, planOf(ops).Changes)
+		if err != nil {
+			logger.Error("Error planning firewall alias, skipping it", errorArgs(err, "name", config.FirewallAlias)...)
+			op = &plannedOp{change: dnsChange{
+				Action:   actionSkip,
+				Hostname: config.FirewallAlias,
+				Type:     recordTypeFirewallAlias,
+				NewValue: strings.Join(currentValues(currentIPs), ","),
+				Reason:   err.Error(),
+			}}
+		}
+		ops = append(ops, *op)
+	}
+
+	if config.Prune {
+		for _, change := range planPrune(config, hostnamesToUse, records, aliases) {
+			if change.Type == recordTypeAlias {
+				ops = append(ops, aliasOp(client, config, change, opnsense.RecordKey{}, uuids))
+				continue
+			}
+			ops = append(ops, recordOp(service, config, change, nil, uuids))
+		}
+	}
+
+	plan := planOf(ops)
+	plan.addresses = currentIPs
+	return plan, nil
+}
+
+// recordOp pairs a host override change with the call applying it, recording
+// the UUID of the override in uuids. Unchanged records whose heartbeat is due
+// get it refreshed.
+func recordOp(service opnsense.RecordService, config *Config, change dnsChange, existing *opnsense.HostOverride, uuids map[opnsense.RecordKey]string) plannedOp {
+	if change.UUID != "" {
+		uuids[opnsense.NewRecordKey(change.Hostname, change.Domain, change.Type)] = change.UUID
+	}
+
+	op := plannedOp{change: change}
+	switch change.Action {
+	case actionCreate, actionUpdate, actionDelete:
+		op.apply = func(ctx context.Context) error { return applyChange(ctx, service, config, change, uuids) }
+	case actionNoop:
+		if existing != nil && heartbeatDue(existing.Description, config.Lease, time.Now()) {
+			op.apply = func(ctx context.Context) error { return refreshHeartbeat(ctx, service, config, change) }
+		}
+	}
+	return op
+}
+
+func planChange(config *Config, hostname, domain, rr, value string, existingRecord *opnsense.HostOverride) (dnsChange, error) {
+	change := dnsChange{
+		Action:   actionCreate,
+		Hostname: hostname,
+		Domain:   domain,
+		Type:     rr,
+		NewValue: value,
+	}
+
+	if existingRecord == nil {
+		logger.Debug("No existing DNS record found, will create new one", "hostname", hostname, "rr", rr)
+		return change, nil
+	}
+
+	change.UUID = existingRecord.UUID
+	change.OldValue = existingRecord.Value()
+	logger.Debug("Found existing DNS record", "hostname", hostname, "rr", rr, "old_ip", change.OldValue, "uuid", change.UUID)
+
+	if tag, ok := ownership.Parse(existingRecord.Description); ok {
+		change.Owner = tag.Owner
+	}
+
+	if existingRecord.MultiAddress() {
+		logger.Warn("Skipping DNS record with several addresses", "hostname", hostname, "rr", rr, "uuid", change.UUID, "value", change.OldValue)
+		change.Action = actionSkip
+		change.Reason = reasonMultiAddress
+		return change, nil
+	}
+
+	if !ownership.OwnedBy(existingRecord.Description, config.InstanceID) {
+		switch config.UnownedPolicy {
+		case ownership.PolicyFail:
+			return change, fmt.Errorf("%s record for %s.%s (uuid %s) is not owned by this agent (owner %q)", rr, hostname, domain, change.UUID, change.Owner)
+		case ownership.PolicySkip:
+			logger.Warn("Skipping DNS record not owned by this agent", "hostname", hostname, "rr", rr, "uuid", change.UUID, "owner", change.Owner)
+			change.Action = actionSkip
+			change.Reason = "not owned by this agent"
+			return change, nil
+		default:
+			logger.Info("Adopting DNS record not owned by this agent", "hostname", hostname, "rr", rr, "uuid", change.UUID, "owner", change.Owner)
+			change.Action = actionUpdate
+			change.Reason = "adopt"
+			return change, nil
+		}
+	}
+
+	switch {
+	case existingRecord.Enabled == "0":
+		change.Action = actionUpdate
+		change.Reason = "re-enable"
+	case existingRecord.EqualValue(value):
+		change.Action = actionNoop
+	default:
+		change.Action = actionUpdate
+	}
+
+	return change, nil
+}
+
+// planWithdrawIPv6 plans the deletion of the AAAA record of hostname owned by
+// this agent when the machine has no IPv6 address (noIPv6), so it does not
+// keep pointing at an address the machine no longer has. When the IPv6 lookup
+// failed the record is skipped instead. A missing IPv4 address leaves the A
+// record alone.
+func planWithdrawIPv6(config *Config, hostname, rr string, noIPv6 bool, existingRecord *opnsense.HostOverride) (dnsChange, bool) {
+	if rr != opnsense.RecordTypeAAAA || existingRecord == nil || !ownership.OwnedBy(existingRecord.Description, config.InstanceID) {
+		return dnsChange{}, false
+	}
+
+	change := dnsChange{
+		Action:   actionDelete,
+		Hostname: hostname,
+		Domain:   config.Domain,
+		Type:     rr,
+		UUID:     existingRecord.UUID,
+		OldValue: existingRecord.Value(),
+		Reason:   "no IPv6 address",
+	}
+	if config.DisableIPv6 {
+		change.Reason = "IPv6 disabled"
+	}
+	if tag, ok := ownership.Parse(existingRecord.Description); ok {
+		change.Owner = tag.Owner
+	}
+	if !noIPv6 {
+		logger.Warn("Keeping AAAA record, IPv6 address unknown", "hostname", hostname, "ip", change.OldValue, "uuid", change.UUID)
+		change.Action = actionSkip
+		change.Reason = reasonIPv6Unknown
+		return change, true
+	}
+	if existingRecord.MultiAddress() {
+		logger.Warn("Not withdrawing AAAA record with several addresses", "hostname", hostname, "value", change.OldValue, "uuid", change.UUID)
+		change.Action = actionSkip
+		change.Reason = reasonMultiAddress
+		return change, true
+	}
+
+	logger.Info("Withdrawing AAAA record without IPv6 address", "hostname", hostname, "ip", change.OldValue, "uuid", change.UUID, "reason", change.Reason)
+	return change, true
+}
+
+// applyPlan applies every pending change of the cycle and reconfigures the
+// backend once at the end, and only if at least one change was applied.
+// Unchanged records whose heartbeat is due get it refreshed, which does not
+// need a reconfigure.
+func applyPlan(ctx context.Context, client *opnsense.Client, config *Config, plan *dnsPlan) {
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		logger.Error("Error selecting DNS backend", "err", err)
+		return
+	}
+
+	applied, pruned, planned, reserved := 0, 0, 0, 0
+	for _, op := range plan.ops {
+		change := op.change
+		if isPrune(change) {
+			planned++
+		}
+		if ctx.Err() != nil {
+			logger.Warn("DNS update cancelled", "err", ctx.Err())
+			break
+		}
+		if op.apply == nil {
+			logger.Debug("Nothing to apply", "hostname", change.Hostname, "rr", change.Type, "action", change.Action, "ip", change.NewValue)
+			continue
+		}
+		err := op.apply(ctx)
+		switch {
+		case change.Action == actionNoop:
+			if err != nil {
+				logger.Error("Error refreshing DNS record heartbeat", "hostname", change.Hostname, "rr", change.Type, "err", err)
+			}
+		case change.Type == recordTypeFirewallAlias:
+			if err != nil {
+				logger.Error("Error updating firewall alias", "name", change.Hostname, "err", err)
+			}
+		case change.Type == recordTypeReservation:
+			if err != nil {
+				logger.Error("Error updating DHCP reservation", "hostname", change.Hostname, "err", err)
+				continue
+			}
+			reserved++
+		case change.Type == recordTypeAlias:
+			if err != nil {
+				logger.Error("Error updating host alias", errorArgs(err, "hostname", change.Hostname, "domain", change.Domain)...)
+				continue
+			}
+			applied++
+		default:
+			if err != nil {
+				logger.Error("Error updating DNS for hostname", errorArgs(err, "hostname", change.Hostname, "rr", change.Type)...)
+				continue
+			}
+			applied++
+			if isPrune(change) {
+				pruned++
+			}
+		}
+	}
+
+	if pruned > 0 {
+		logger.Info("Pruned stale DNS records", "deleted", pruned, "planned", planned)
+	}
+
+	if reserved > 0 {
+		if err := client.Kea.ReconfigureService(ctx); err != nil {
+			logger.Error("DHCP reservation changed but failed to reconfigure service", "err", err)
+		}
+	}
+
+	if applied == 0 {
+		return
+	}
+
+	if err := service.ReconfigureService(ctx); err != nil {
+		logger.Error("DNS records changed but failed to reconfigure service", "changes", applied, "err", err)
+	}
+}
+
+func applyChange(ctx context.Context, service opnsense.RecordService, config *Config, change dnsChange, uuids map[opnsense.RecordKey]string) error {
+	record := opnsense.NewDNSRecord(change.Hostname, change.Domain, change.Type, change.NewValue)
+	record.Description = ownership.Describe(config.InstanceID)
+
+	switch change.Action {
+	case actionDelete:
+		logger.Info("Deleting stale DNS record", "hostname", change.Hostname, "domain", change.Domain, "rr", change.Type, "ip", change.OldValue, "uuid", change.UUID, "reason", change.Reason)
+		record.UUID = change.UUID
+		if err := service.DeleteHostOverride(ctx, record); err != nil {
+			return fmt.Errorf("error deleting DNS record: %w", err)
+		}
+	case actionUpdate:
+		logger.Info("IP changed, updating DNS", "hostname", change.Hostname, "rr", change.Type, "old_ip", change.OldValue, "new_ip", change.NewValue)
+		record.UUID = change.UUID
+		record.Enabled = "1"
+		if err := service.UpdateHostOverride(ctx, record); err != nil {
+			return fmt.Errorf("error updating DNS record: %w", err)
+		}
+	case actionCreate:
+		logger.Info("IP changed, updating DNS", "hostname", change.Hostname, "rr", change.Type, "old_ip", "none", "new_ip", change.NewValue)
+		if err := service.CreateHostOverride(ctx, record); err != nil {
+			return fmt.Errorf("error creating DNS record: %w", err)
+		}
+		uuids[opnsense.NewRecordKey(change.Hostname, change.Domain, change.Type)] = record.UUID
+	}
+
+	return nil
+}
+
+// heartbeatDue reports whether the heartbeat in description is older than a
+// quarter of lease (in minutes), so a record is rewritten a few times per
+// lease instead of every cycle. Records without a heartbeat are always due.
+func heartbeatDue(description string, lease int, now time.Time) bool {
+	tag, ok := ownership.Parse(description)
+	if !ok || tag.Seen.IsZero() {
+		return true
+	}
+	return now.Sub(tag.Seen) >= time.Duration(lease)*time.Minute/4
+}
+
+func refreshHeartbeat(ctx context.Context, service opnsense.RecordService, config *Config, change dnsChange) error {
+	logger.Debug("IP unchanged, refreshing heartbeat", "hostname", change.Hostname, "rr", change.Type, "ip", change.OldValue, "uuid", change.UUID)
+
+	record := opnsense.NewDNSRecord(change.Hostname, change.Domain, change.Type, change.OldValue)
+	record.Description = ownership.Describe(config.InstanceID)
+	record.UUID = change.UUID
+	record.Enabled = "1"
+	if err := service.UpdateHostOverride(ctx, record); err != nil {
+		return fmt.Errorf("error updating DNS record: %w", err)
+	}
+	return nil
+}
+
+func printPlan(w io.Writer, plan *dnsPlan, format string) error {
+	if format == formatJSON {
+		return writeJSON(w, struct {
+			Changes []dnsChange    `json:"changes"`
+			Summary map[string]int `json:"summary"`
+			Pending bool           `json:"pending"`
+		}{
+			Changes: append([]dnsChange{}, plan.Changes...),
+			Summary: map[string]int{
+				actionCreate:  plan.count(actionCreate),
+				actionUpdate:  plan.count(actionUpdate),
+				actionNoop:    plan.count(actionNoop),
+				actionSkip:    plan.count(actionSkip),
+				actionDelete:  plan.count(actionDelete),
+				actionDisable: plan.count(actionDisable),
+			},
+			Pending: plan.HasChanges(),
+		})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, change := range plan.Changes {
+		symbol := map[string]string{actionCreate: "+", actionUpdate: "~", actionNoop: "=", actionSkip: "!", actionDelete: "-", actionDisable: "x"}[change.Action]
+		value := change.NewValue
+		if change.NewValue == "" {
+			value = change.OldValue
+		}
+		if change.Action == actionUpdate && change.OldValue != change.NewValue {
+			value = fmt.Sprintf("%s -> %s", change.OldValue, change.NewValue)
+		}
+		if change.Reason != "" {
+			value = fmt.Sprintf("%s (%s)", value, change.Reason)
+		}
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\n", symbol, change.Action, change.Name(), change.Type, value)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete, %d to disable, %d unchanged, %d skipped.\n", plan.count(actionCreate), plan.count(actionUpdate), plan.count(actionDelete), plan.count(actionDisable), plan.count(actionNoop), plan.count(actionSkip))
+	return err
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+func TestPlanChange(t *testing.T) {
+	const (
+		owned   = "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00 [opnsense-auto-dns owner=web1]"
+		foreign = "x [opnsense-auto-dns owner=web2]"
+		legacy  = "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00"
+	)
+
+	tests := []struct {
+		name       string
+		rr         string
+		value      string
+		existing   *opnsense.HostOverride
+		policy     string
+		wantAction string
+		wantReason string
+		wantOwner  string
+		wantErr    bool
+	}{
+		{name: "missing", rr: "A", value: "192.0.2.1", wantAction: actionCreate},
+		{name: "unchanged", rr: "A", value: "192.0.2.1", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: owned}, wantAction: actionNoop, wantOwner: "web1"},
+		{name: "unchanged in other notation", rr: "AAAA", value: "2001:db8::1", existing: &opnsense.HostOverride{UUID: "1", Server: "2001:0db8:0::1", Description: owned}, wantAction: actionNoop, wantOwner: "web1"},
+		{name: "changed", rr: "A", value: "192.0.2.2", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: owned}, wantAction: actionUpdate, wantOwner: "web1"},
+		{name: "legacy is owned", rr: "A", value: "192.0.2.2", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: legacy}, wantAction: actionUpdate},
+		{name: "foreign adopted", rr: "A", value: "192.0.2.1", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: foreign}, policy: ownership.PolicyAdopt, wantAction: actionUpdate, wantReason: "adopt", wantOwner: "web2"},
+		{name: "foreign skipped", rr: "A", value: "192.0.2.2", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: foreign}, policy: ownership.PolicySkip, wantAction: actionSkip, wantReason: "not owned by this agent", wantOwner: "web2"},
+		{name: "manual skipped", rr: "A", value: "192.0.2.2", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: "Printer"}, policy: ownership.PolicySkip, wantAction: actionSkip, wantReason: "not owned by this agent"},
+		{name: "disabled re-enabled", rr: "A", value: "192.0.2.1", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: owned, Enabled: "0"}, wantAction: actionUpdate, wantReason: "re-enable", wantOwner: "web1"},
+		{name: "MX unchanged", rr: "MX", value: "10 mail.home.lan", existing: &opnsense.HostOverride{UUID: "1", RR: "MX", MXPrio: "10", MX: "mail.home.lan", Description: owned}, wantAction: actionNoop, wantOwner: "web1"},
+		{name: "MX priority changed", rr: "MX", value: "20 mail.home.lan", existing: &opnsense.HostOverride{UUID: "1", RR: "MX", MXPrio: "10", MX: "mail.home.lan", Description: owned}, wantAction: actionUpdate, wantOwner: "web1"},
+		{name: "TXT changed", rr: "TXT", value: "v=spf1 -all", existing: &opnsense.HostOverride{UUID: "1", RR: "TXT", TXTData: "v=spf1 mx -all", Description: owned}, wantAction: actionUpdate, wantOwner: "web1"},
+		{name: "several addresses skipped", rr: "A", value: "192.0.2.1", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1,192.0.2.2", Description: owned}, wantAction: actionSkip, wantReason: reasonMultiAddress, wantOwner: "web1"},
+		{name: "foreign fails", rr: "A", value: "192.0.2.2", existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: foreign}, policy: ownership.PolicyFail, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Domain: "home.lan", InstanceID: "web1", UnownedPolicy: tt.policy}
+			if tt.existing != nil {
+				tt.existing.Hostname, tt.existing.Domain = "host", "home.lan"
+			}
+
+			change, err := planChange(config, "host", config.Domain, tt.rr, tt.value, tt.existing)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("planChange planned %s, want error", change.Action)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planChange failed: %v", err)
+			}
+			if change.Action != tt.wantAction || change.Reason != tt.wantReason || change.Owner != tt.wantOwner {
+				t.Errorf("planChange = %s (%q, owner %q), want %s (%q, owner %q)", change.Action, change.Reason, change.Owner, tt.wantAction, tt.wantReason, tt.wantOwner)
+			}
+			if change.NewValue != tt.value {
+				t.Errorf("planChange new value = %q, want %q", change.NewValue, tt.value)
+			}
+		})
+	}
+}
+
+func TestHeartbeatDue(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		description string
+		want        bool
+	}{
+		{name: "fresh", description: "x [opnsense-auto-dns owner=web1 seen=2025-01-10T11:00:00Z]", want: false},
+		{name: "quarter of lease", description: "x [opnsense-auto-dns owner=web1 seen=2025-01-10T06:00:00Z]", want: true},
+		{name: "expired", description: "x [opnsense-auto-dns owner=web1 seen=2025-01-01T00:00:00Z]", want: true},
+		{name: "no heartbeat", description: "x [opnsense-auto-dns owner=web1]", want: true},
+		{name: "legacy", description: "Auto-updated by opnsense-auto-dns at 2025-01-10 11:00:00", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heartbeatDue(tt.description, defaultLease, now); got != tt.want {
+				t.Errorf("heartbeatDue(%q) = %v, want %v", tt.description, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanWithdrawIPv6(t *testing.T) {
+	const owned = "x [opnsense-auto-dns owner=web1]"
+
+	tests := []struct {
+		name       string
+		rr         string
+		noIPv6     bool
+		existing   *opnsense.HostOverride
+		wantAction string
+		wantReason string
+		wantOK     bool
+	}{
+		{name: "no record", rr: "AAAA", noIPv6: true},
+		{name: "A record kept", rr: "A", noIPv6: true, existing: &opnsense.HostOverride{UUID: "1", Server: "192.0.2.1", Description: owned}},
+		{name: "foreign kept", rr: "AAAA", noIPv6: true, existing: &opnsense.HostOverride{UUID: "1", Server: "2001:db8::1", Description: "x [opnsense-auto-dns owner=web2]"}},
+		{name: "no address withdrawn", rr: "AAAA", noIPv6: true, existing: &opnsense.HostOverride{UUID: "1", Server: "2001:db8::1", Description: owned}, wantAction: actionDelete, wantReason: "no IPv6 address", wantOK: true},
+		{name: "failed lookup skipped", rr: "AAAA", existing: &opnsense.HostOverride{UUID: "1", Server: "2001:db8::1", Description: owned}, wantAction: actionSkip, wantReason: reasonIPv6Unknown, wantOK: true},
+		{name: "legacy failed lookup skipped", rr: "AAAA", existing: &opnsense.HostOverride{UUID: "1", Server: "2001:db8::1", Description: "Auto-updated by opnsense-auto-dns"}, wantAction: actionSkip, wantReason: reasonIPv6Unknown, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Domain: "home.lan", InstanceID: "web1"}
+			change, ok := planWithdrawIPv6(config, "host", tt.rr, tt.noIPv6, tt.existing)
+			if ok != tt.wantOK {
+				t.Fatalf("planWithdrawIPv6 planned %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (change.Action != tt.wantAction || change.Reason != tt.wantReason) {
+				t.Errorf("planWithdrawIPv6 = %s (%q), want %s (%q)", change.Action, change.Reason, tt.wantAction, tt.wantReason)
+			}
+		})
+	}
+}
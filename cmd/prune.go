@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"strings"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+const defaultMaxPrune = 10
+
+// reasonPrune is the reason of the deletions planned by planPrune.
+const reasonPrune = "no longer configured"
+
+// planPrune plans the deletion of records tagged as owned by this agent that
+// are no longer configured: A and AAAA records of hostnames that were removed
+// and other records removed from records. Untagged (legacy) records are never
+// pruned since they cannot be attributed to a single agent. Aliases of other
+// owners attached to a pruned record are deleted before it; the agent's own
+// are deleted by planAliases. If more records would be deleted than max_prune
+// allows, none are deleted.
+func planPrune(config *Config, hostnames []string, records []opnsense.HostOverride, aliases []opnsense.HostAlias) []dnsChange {
+	desiredHosts := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		desiredHosts[strings.ToLower(hostname)+"."+strings.ToLower(config.Domain)] = true
+	}
+	desiredRecords := make(map[opnsense.RecordKey]bool, len(config.Records))
+	for _, record := range config.Records {
+		desiredRecords[opnsense.NewRecordKey(record.Hostname, record.Domain, record.Type)] = true
+	}
+
+	var changes []dnsChange
+	for _, record := range records {
+		tag, ok := ownership.Parse(record.Description)
+		if !ok || tag.Owner != config.InstanceID {
+			continue
+		}
+		switch record.RecordType() {
+		case opnsense.RecordTypeA, opnsense.RecordTypeAAAA:
+			if desiredHosts[strings.ToLower(record.Hostname)+"."+strings.ToLower(record.Domain)] {
+				continue
+			}
+		}
+		if desiredRecords[opnsense.NewRecordKey(record.Hostname, record.Domain, record.RecordType())] {
+			continue
+		}
+
+		change := dnsChange{
+			Action:   actionDelete,
+			Hostname: record.Hostname,
+			Domain:   record.Domain,
+			Type:     record.RecordType(),
+			UUID:     record.UUID,
+			OldValue: record.Value(),
+			Owner:    tag.Owner,
+			Reason:   reasonPrune,
+		}
+		if record.MultiAddress() {
+			change.Action = actionSkip
+			change.Reason = reasonMultiAddress
+			changes = append(changes, change)
+			continue
+		}
+		for _, alias := range aliasesOf(&record, aliases) {
+			if ownership.TaggedBy(alias.Description, config.InstanceID) {
+				continue
+			}
+			aliasChange := dnsChange{
+				Action:   actionDelete,
+				Hostname: alias.Hostname,
+				Domain:   alias.Domain,
+				Type:     recordTypeAlias,
+				UUID:     alias.UUID,
+				OldValue: record.Hostname + "." + record.Domain,
+				Reason:   "host override pruned",
+			}
+			if aliasTag, ok := ownership.Parse(alias.Description); ok {
+				aliasChange.Owner = aliasTag.Owner
+			}
+			changes = append(changes, aliasChange)
+		}
+		changes = append(changes, change)
+	}
+
+	stale := 0
+	for _, change := range changes {
+		if isPrune(change) {
+			stale++
+		}
+	}
+	if stale > config.MaxPrune {
+		logger.Error("Refusing to prune stale DNS records, too many deletions", "stale", stale, "max_prune", config.MaxPrune)
+		for i := range changes {
+			if changes[i].Action == actionDelete {
+				changes[i].Action = actionSkip
+				changes[i].Reason = "prune limit exceeded"
+			}
+		}
+	}
+
+	for _, change := range changes {
+		logger.Debug("Planned prune of stale DNS record", "hostname", change.Hostname, "domain", change.Domain, "rr", change.Type, "uuid", change.UUID, "action", change.Action)
+	}
+
+	return changes
+}
+
+// isPrune reports whether change is a deletion planned by planPrune, as
+// opposed to the withdrawal of an AAAA record or of a host alias.
+func isPrune(change dnsChange) bool {
+	return change.Action == actionDelete && change.Type != recordTypeAlias && change.Reason == reasonPrune
+}
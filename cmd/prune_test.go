@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/recordfile"
+)
+
+func TestPlanPrune(t *testing.T) {
+	const (
+		owned   = "x [opnsense-auto-dns owner=web1]"
+		foreign = "x [opnsense-auto-dns owner=web2]"
+		legacy  = "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00"
+	)
+	records := []opnsense.HostOverride{
+		{UUID: "kept", Hostname: "web", Domain: "home.lan", RR: "A", Description: owned},
+		{UUID: "kept-case", Hostname: "WEB", Domain: "Home.Lan", RR: "AAAA", Description: owned},
+		{UUID: "stale", Hostname: "old", Domain: "home.lan", RR: "A", Description: owned},
+		{UUID: "stale-domain", Hostname: "web", Domain: "other.lan", RR: "A", Description: owned},
+		{UUID: "foreign", Hostname: "old", Domain: "home.lan", RR: "AAAA", Description: foreign},
+		{UUID: "legacy", Hostname: "older", Domain: "home.lan", RR: "A", Description: legacy},
+		{UUID: "manual", Hostname: "printer", Domain: "home.lan", RR: "A", Description: "Printer"},
+		{UUID: "mx", Hostname: "home.lan", Domain: "home.lan", RR: "MX", Description: owned},
+		{UUID: "txt", Hostname: "web", Domain: "home.lan", RR: "TXT", Description: owned},
+		{UUID: "multi", Hostname: "multi", Domain: "home.lan", Server: "192.0.2.1,192.0.2.2", Description: owned},
+	}
+
+	aliases := []opnsense.HostAlias{
+		{UUID: "alias-manual", Host: "stale", Hostname: "www", Domain: "home.lan", Description: "Website"},
+		{UUID: "alias-owned", Host: "old.home.lan", Hostname: "ftp", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web1]"},
+		{UUID: "alias-kept", Host: "kept", Hostname: "mail", Domain: "home.lan", Description: "Mail"},
+	}
+
+	tests := []struct {
+		name     string
+		maxPrune int
+		want     map[string]string
+	}{
+		{name: "within limit", maxPrune: 10, want: map[string]string{"alias-manual": actionDelete, "stale": actionDelete, "stale-domain": actionDelete, "txt": actionDelete, "multi": actionSkip}},
+		{name: "at limit", maxPrune: 3, want: map[string]string{"alias-manual": actionDelete, "stale": actionDelete, "stale-domain": actionDelete, "txt": actionDelete, "multi": actionSkip}},
+		{name: "over limit", maxPrune: 2, want: map[string]string{"alias-manual": actionSkip, "stale": actionSkip, "stale-domain": actionSkip, "txt": actionSkip, "multi": actionSkip}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Domain:     "home.lan",
+				InstanceID: "web1",
+				MaxPrune:   tt.maxPrune,
+				Records:    []recordfile.Record{{Hostname: "home.lan", Domain: "home.lan", Type: "MX", Value: "mail.home.lan"}},
+			}
+
+			changes := planPrune(config, []string{"web"}, records, aliases)
+			if len(changes) != len(tt.want) {
+				t.Fatalf("planPrune planned %d changes, want %d: %+v", len(changes), len(tt.want), changes)
+			}
+			for i, change := range changes {
+				if want, ok := tt.want[change.UUID]; !ok || change.Action != want {
+					t.Errorf("planPrune planned %s for %s, want %q", change.Action, change.UUID, want)
+				}
+				if change.Type == recordTypeAlias && (i+1 == len(changes) || changes[i+1].UUID != "stale") {
+					t.Errorf("planPrune planned alias %s not right before its host override", change.UUID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+)
+
+var (
+	sweepLease  time.Duration
+	sweepAction string
+	sweepOwners []string
+	sweepDomain string
+	sweepDryRun bool
+	sweepOutput string
+)
+
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Remove DNS records whose agent stopped sending heartbeats",
+	Long: `Sweep looks at every host override carrying an opnsense-auto-dns ownership tag and deletes
+(or disables) those whose heartbeat is older than the lease. Agents refresh the heartbeat
+of their records on every update, so records of machines that are switched off or gone for good
+expire once the lease runs out. It is meant to run centrally, e.g. from cron. The host aliases
+of deleted overrides are deleted with them.
+
+The lease should be comfortably longer than the interval of the agents. Records without a
+heartbeat (created by hand or by releases without heartbeats) are never swept.
+
+The Unbound host overrides are swept by default, the Dnsmasq host entries with backend (BACKEND,
+--backend) set to dnsmasq. Dnsmasq entries cannot be disabled, so only --action delete is
+supported for them. Entries with several addresses are left alone.
+
+Examples:
+  # Delete records not refreshed for a day
+  opnsense-auto-dns sweep --config config.json --lease 24h
+
+  # Show which records of one domain would be disabled after a week
+  opnsense-auto-dns sweep --config config.json --lease 168h --action disable --domain home.local --dry-run`,
+	Run: runSweep,
+}
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+
+	sweepCmd.Flags().DurationVar(&sweepLease, "lease", 24*time.Hour, "how long a record stays after its last heartbeat")
+	sweepCmd.Flags().StringVar(&sweepAction, "action", actionDelete, "what to do with expired records: delete or disable")
+	sweepCmd.Flags().StringSliceVar(&sweepOwners, "owner", []string{}, "only sweep records of these instance IDs")
+	sweepCmd.Flags().StringVar(&sweepDomain, "domain", "", "only sweep records in this domain")
+	sweepCmd.Flags().StringVar(&backend, "backend", "", "DNS service to sweep the records of: unbound or dnsmasq (overrides config file)")
+	sweepCmd.Flags().BoolVar(&sweepDryRun, "dry-run", false, "print the expired records without changing them")
+	sweepCmd.Flags().StringVarP(&sweepOutput, "output", "o", formatText, "output format for --dry-run (text, json)")
+	addConnectionFlags(sweepCmd)
+}
+
+func runSweep(cmd *cobra.Command, args []string) {
+	if sweepLease <= 0 {
+		logger.Fatal("lease must be positive", "lease", sweepLease)
+	}
+	if sweepAction != actionDelete && sweepAction != actionDisable {
+		logger.Fatal("Invalid sweep action", "action", sweepAction, "expected", []string{actionDelete, actionDisable})
+	}
+	if sweepDryRun {
+		if err := checkOutputFormat(sweepOutput, formatText, formatJSON); err != nil {
+			logger.Fatal("Invalid output format", "err", err)
+		}
+		logger.SetOutput(os.Stderr)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+	if sweepAction == actionDisable && config.Backend == opnsense.BackendDnsmasq {
+		logger.Fatal("Sweep action disable is not supported by the dnsmasq backend, use delete")
+	}
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+	service, err := client.Records(config.Backend)
+	if err != nil {
+		logger.Fatal("Error getting existing DNS records", "err", err)
+	}
+
+	records, err := service.SearchHostOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error getting existing DNS records", "err", err)
+	}
+
+	// Deleted overrides take their host aliases with them; Dnsmasq has none
+	// and disabled overrides keep theirs.
+	var aliases []opnsense.HostAlias
+	if config.Backend == opnsense.BackendUnbound && sweepAction == actionDelete {
+		aliases, err = client.Unbound.SearchHostAliases(ctx, "")
+		if err != nil {
+			logger.Fatal("Error getting existing host aliases", "err", err)
+		}
+	}
+
+	plan, expired := planSweep(records, aliases, time.Now())
+	logger.Info("Found expired DNS records", "total", len(records), "expired", len(expired), "lease", sweepLease)
+
+	if sweepDryRun {
+		if err := printPlan(os.Stdout, plan, sweepOutput); err != nil {
+			logger.Fatal("Error printing plan", "err", err)
+		}
+		if plan.HasChanges() {
+			os.Exit(exitChangesPending)
+		}
+		return
+	}
+
+	swept, err := applySweep(ctx, client, service, expired, aliases)
+	if err != nil {
+		logger.Fatal("Error sweeping DNS records", "swept", swept, "err", err)
+	}
+
+	logger.Info("Swept expired DNS records", "action", sweepAction, "swept", swept)
+}
+
+// planSweep plans the sweep of the records whose heartbeat expired. The aliases
+// attached to a deleted record are deleted before it.
+func planSweep(records []opnsense.HostOverride, aliases []opnsense.HostAlias, now time.Time) (*dnsPlan, []opnsense.HostOverride) {
+	plan := &dnsPlan{}
+	var expired []opnsense.HostOverride
+	for _, record := range records {
+		tag, ok := ownership.Parse(record.Description)
+		if !ok || !tag.Expired(sweepLease, now) {
+			continue
+		}
+		if sweepDomain != "" && !strings.EqualFold(record.Domain, sweepDomain) {
+			continue
+		}
+		if len(sweepOwners) > 0 && !slices.Contains(sweepOwners, tag.Owner) {
+			continue
+		}
+
+		change := dnsChange{
+			Action:   sweepAction,
+			Hostname: record.Hostname,
+			Domain:   record.Domain,
+			Type:     record.RecordType(),
+			UUID:     record.UUID,
+			OldValue: record.Value(),
+			Owner:    tag.Owner,
+			Reason:   fmt.Sprintf("last seen %s", tag.Seen.Local().Format("2006-01-02 15:04:05")),
+		}
+		switch {
+		case record.MultiAddress():
+			change.Action = actionSkip
+			change.Reason = reasonMultiAddress
+		case sweepAction == actionDisable && record.Enabled == "0":
+			change.Action = actionNoop
+			change.Reason = "already disabled"
+		default:
+			expired = append(expired, record)
+			if sweepAction == actionDelete {
+				plan.Changes = append(plan.Changes, sweepAliases(&record, aliases)...)
+			}
+		}
+
+		logger.Debug("DNS record heartbeat expired", "hostname", record.Hostname, "domain", record.Domain, "rr", change.Type, "owner", tag.Owner, "seen", tag.Seen, "action", change.Action)
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	return plan, expired
+}
+
+func sweepAliases(record *opnsense.HostOverride, aliases []opnsense.HostAlias) []dnsChange {
+	var changes []dnsChange
+	for _, alias := range aliasesOf(record, aliases) {
+		change := dnsChange{
+			Action:   actionDelete,
+			Hostname: alias.Hostname,
+			Domain:   alias.Domain,
+			Type:     recordTypeAlias,
+			UUID:     alias.UUID,
+			OldValue: record.Hostname + "." + record.Domain,
+			Reason:   "host override swept",
+		}
+		if tag, ok := ownership.Parse(alias.Description); ok {
+			change.Owner = tag.Owner
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// applySweep deletes or disables the expired records, deleting the aliases
+// attached to a record first, and reconfigures the service once at the end.
+func applySweep(ctx context.Context, client *opnsense.Client, service opnsense.RecordService, expired []opnsense.HostOverride, aliases []opnsense.HostAlias) (int, error) {
+	swept, changed := 0, 0
+	var sweepErr error
+	for i := range expired {
+		record := &expired[i]
+		if sweepAction == actionDisable {
+			record.RR = record.RecordType()
+			record.Enabled = "0"
+			sweepErr = service.UpdateHostOverride(ctx, record)
+		} else {
+			for _, alias := range aliasesOf(record, aliases) {
+				if sweepErr = client.Unbound.DeleteHostAlias(ctx, &alias); sweepErr != nil {
+					break
+				}
+				changed++
+			}
+			if sweepErr == nil {
+				sweepErr = service.DeleteHostOverride(ctx, record)
+			}
+		}
+		if sweepErr != nil {
+			sweepErr = fmt.Errorf("error sweeping %s record for %s.%s: %v", record.RecordType(), record.Hostname, record.Domain, sweepErr)
+			break
+		}
+		swept++
+		changed++
+	}
+
+	return swept, reconfigureAfterChanges(ctx, service, changed, sweepErr)
+}
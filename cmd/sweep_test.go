@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+)
+
+func TestPlanSweep(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	records := []opnsense.HostOverride{
+		{UUID: "fresh", Hostname: "a", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web1 seen=2025-01-10T00:00:00Z]", Enabled: "1"},
+		{UUID: "expired", Hostname: "b", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web1 seen=2025-01-01T00:00:00Z]", Enabled: "1"},
+		{UUID: "expired-other", Hostname: "c", Domain: "other.lan", Description: "x [opnsense-auto-dns owner=web2 seen=2025-01-01T00:00:00Z]", Enabled: "1"},
+		{UUID: "disabled", Hostname: "d", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web2 seen=2025-01-01T00:00:00Z]", Enabled: "0"},
+		{UUID: "no-heartbeat", Hostname: "e", Domain: "home.lan", Description: "x [opnsense-auto-dns owner=web1]", Enabled: "1"},
+		{UUID: "legacy", Hostname: "f", Domain: "home.lan", Description: "Auto-updated by opnsense-auto-dns at 2025-01-01 00:00:00", Enabled: "1"},
+		{UUID: "manual", Hostname: "g", Domain: "home.lan", Description: "Printer", Enabled: "1"},
+		{UUID: "multi", Hostname: "h", Domain: "home.lan", Server: "192.0.2.1,192.0.2.2", Description: "x [opnsense-auto-dns owner=web1 seen=2025-01-01T00:00:00Z]", Enabled: "1"},
+	}
+
+	aliases := []opnsense.HostAlias{
+		{UUID: "alias-expired", Host: "expired", Hostname: "www", Domain: "home.lan"},
+		{UUID: "alias-fresh", Host: "a.home.lan", Hostname: "ftp", Domain: "home.lan"},
+	}
+
+	tests := []struct {
+		name        string
+		action      string
+		owners      []string
+		domain      string
+		want        map[string]string
+		wantExpired int
+	}{
+		{
+			name:        "delete",
+			action:      actionDelete,
+			want:        map[string]string{"alias-expired": actionDelete, "expired": actionDelete, "expired-other": actionDelete, "disabled": actionDelete, "multi": actionSkip},
+			wantExpired: 3,
+		},
+		{
+			name:        "disable",
+			action:      actionDisable,
+			want:        map[string]string{"expired": actionDisable, "expired-other": actionDisable, "disabled": actionNoop, "multi": actionSkip},
+			wantExpired: 2,
+		},
+		{
+			name:        "owner filter",
+			action:      actionDelete,
+			owners:      []string{"web2"},
+			want:        map[string]string{"expired-other": actionDelete, "disabled": actionDelete},
+			wantExpired: 2,
+		},
+		{
+			name:        "domain filter",
+			action:      actionDelete,
+			domain:      "Other.Lan",
+			want:        map[string]string{"expired-other": actionDelete},
+			wantExpired: 1,
+		},
+	}
+
+	lease, action, owners, domain := sweepLease, sweepAction, sweepOwners, sweepDomain
+	t.Cleanup(func() {
+		sweepLease, sweepAction, sweepOwners, sweepDomain = lease, action, owners, domain
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sweepLease, sweepAction, sweepOwners, sweepDomain = 24*time.Hour, tt.action, tt.owners, tt.domain
+
+			plan, expired := planSweep(records, aliases, now)
+			if len(plan.Changes) != len(tt.want) {
+				t.Fatalf("planSweep planned %d changes, want %d: %+v", len(plan.Changes), len(tt.want), plan.Changes)
+			}
+			for i, change := range plan.Changes {
+				if want, ok := tt.want[change.UUID]; !ok || change.Action != want {
+					t.Errorf("planSweep planned %s for %s, want %q", change.Action, change.UUID, want)
+				}
+				if change.Type == recordTypeAlias && (i+1 == len(plan.Changes) || plan.Changes[i+1].UUID != "expired") {
+					t.Errorf("planSweep planned alias %s not right before its host override", change.UUID)
+				}
+			}
+			if len(expired) != tt.wantExpired {
+				t.Errorf("planSweep returned %d expired records, want %d", len(expired), tt.wantExpired)
+			}
+		})
+	}
+}
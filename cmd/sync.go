@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+	"opnsense-auto-dns/internal/logger"
+	"opnsense-auto-dns/internal/ownership"
+	"opnsense-auto-dns/internal/recordfile"
+)
+
+var (
+	syncFile   string
+	syncDelete bool
+	syncDryRun bool
+	syncOutput string
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Reconcile host overrides with a desired-state records file",
+	Long: `Sync reads a YAML or JSON file of desired records and makes the Unbound host overrides
+match it: missing records are created and records whose value, description or enabled state
+differ are updated. With --delete, records previously written by sync with the same instance ID
+that are no longer in the file are deleted. The plan is printed before it is applied.
+
+Records written by sync carry an ownership tag with the instance ID (instance_id, INSTANCE_ID,
+--instance-id), so use a dedicated instance ID per records file. Existing records that are not
+owned by it are handled according to unowned_policy (adopt, skip or fail).
+
+Records file format (files ending in .json are read as JSON):
+
+  domain: home.local          # default domain for all records
+  records:
+    - hostname: nas
+      type: A                 # A (default), AAAA, MX or TXT
+      value: 192.168.1.20
+      description: NAS
+    - hostname: nas
+      type: MX
+      value: mail.home.local  # mail server, priority defaults to 10
+      priority: 20
+    - hostname: nas
+      type: TXT
+      value: "v=spf1 -all"
+    - hostname: printer
+      domain: office.local
+      value: 192.168.2.5
+      enabled: false
+
+Exit codes with --dry-run:
+  0  no changes pending
+  1  error
+  2  changes pending
+
+Examples:
+  # Show what would change
+  opnsense-auto-dns sync --config config.json --file records.yaml --dry-run
+
+  # Apply, deleting records removed from the file
+  opnsense-auto-dns sync --config config.json --file records.yaml --instance-id zone-home --delete`,
+	Run: runSync,
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVarP(&syncFile, "file", "f", "", "desired-state records file (YAML or JSON)")
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "delete records owned by this instance that are not in the file")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "print the planned changes without applying them")
+	syncCmd.Flags().StringVarP(&syncOutput, "output", "o", formatText, "plan output format (text, json)")
+	syncCmd.Flags().StringVar(&unownedPolicy, "unowned-policy", "", "what to do with matching records this instance does not own: adopt, skip or fail (overrides config file)")
+	syncCmd.MarkFlagRequired("file")
+	addConnectionFlags(syncCmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) {
+	if err := checkOutputFormat(syncOutput, formatText, formatJSON); err != nil {
+		logger.Fatal("Invalid output format", "err", err)
+	}
+	logger.SetOutput(os.Stderr)
+
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+
+	desired, err := recordfile.Load(syncFile)
+	if err != nil {
+		logger.Fatal("Error loading records file", "err", err)
+	}
+	logger.Info("Loaded desired records", "path", syncFile, "records", len(desired))
+
+	ctx, stop := commandContext(config)
+	defer stop()
+
+	client := newClient(config)
+
+	records, err := client.Unbound.SearchHostOverrides(ctx, "")
+	if err != nil {
+		logger.Fatal("Error getting existing DNS records", "err", err)
+	}
+
+	ops, err := planSync(client, config, desired, records)
+	if err != nil {
+		logger.Fatal("Error planning sync", "err", err)
+	}
+
+	plan := planOf(ops)
+	if err := printPlan(os.Stdout, plan, syncOutput); err != nil {
+		logger.Fatal("Error printing plan", "err", err)
+	}
+
+	if syncDryRun {
+		if plan.HasChanges() {
+			os.Exit(exitChangesPending)
+		}
+		return
+	}
+
+	applied, err := applyOps(ctx, client, ops)
+	if err != nil {
+		logger.Fatal("Error applying sync", "applied", applied, "err", err)
+	}
+
+	logger.Info("Synced DNS records", "applied", applied)
+}
+
+func planSync(client *opnsense.Client, config *Config, desired []recordfile.Record, records []opnsense.HostOverride) ([]plannedOp, error) {
+	index := opnsense.NewHostOverrideIndex(records)
+	wanted := make(map[opnsense.RecordKey]bool, len(desired))
+
+	var ops []plannedOp
+	for _, d := range desired {
+		wanted[opnsense.NewRecordKey(d.Hostname, d.Domain, d.Type)] = true
+
+		record := opnsense.NewDNSRecord(d.Hostname, d.Domain, d.Type, d.RecordValue())
+		record.Description = ownership.Annotate(d.Description, config.InstanceID)
+		record.Enabled = "0"
+		if d.IsEnabled() {
+			record.Enabled = "1"
+		}
+
+		change := dnsChange{
+			Action:   actionCreate,
+			Hostname: d.Hostname,
+			Domain:   d.Domain,
+			Type:     d.Type,
+			NewValue: record.Value(),
+		}
+		apply := func(ctx context.Context) error { return client.Unbound.CreateHostOverride(ctx, record) }
+
+		existing := index.Get(d.Hostname, d.Domain, d.Type)
+		if existing != nil {
+			change.UUID = existing.UUID
+			change.OldValue = existing.Value()
+			record.UUID = existing.UUID
+			apply = func(ctx context.Context) error { return client.Unbound.UpdateHostOverride(ctx, record) }
+			if tag, ok := ownership.Parse(existing.Description); ok {
+				change.Owner = tag.Owner
+			}
+
+			// Legacy records belong to the auto-updater agent managing the
+			// hostname, so sync only claims records tagged with its own ID.
+			owned := ownership.TaggedBy(existing.Description, config.InstanceID)
+			diff := syncDiff(existing, record)
+			switch {
+			case !owned && config.UnownedPolicy == ownership.PolicyFail:
+				return nil, fmt.Errorf("%s record for %s.%s (uuid %s) is not owned by this instance (owner %q)", d.Type, d.Hostname, d.Domain, existing.UUID, change.Owner)
+			case !owned && config.UnownedPolicy == ownership.PolicySkip:
+				logger.Warn("Skipping DNS record not owned by this instance", "hostname", d.Hostname, "domain", d.Domain, "rr", d.Type, "uuid", existing.UUID, "owner", change.Owner)
+				change.Action = actionSkip
+				change.Reason = "not owned by this instance"
+			case !owned:
+				change.Action = actionUpdate
+				change.Reason = "adopt"
+			case len(diff) == 0:
+				change.Action = actionNoop
+			default:
+				change.Action = actionUpdate
+				change.Reason = strings.Join(diff, ", ")
+			}
+		}
+
+		ops = append(ops, plannedOp{change: change, apply: apply})
+	}
+
+	if !syncDelete {
+		return ops, nil
+	}
+
+	for i := range records {
+		record := &records[i]
+		tag, ok := ownership.Parse(record.Description)
+		if !ok || tag.Owner != config.InstanceID {
+			continue
+		}
+		if wanted[opnsense.NewRecordKey(record.Hostname, record.Domain, record.RecordType())] {
+			continue
+		}
+
+		ops = append(ops, plannedOp{
+			change: dnsChange{
+				Action:   actionDelete,
+				Hostname: record.Hostname,
+				Domain:   record.Domain,
+				Type:     record.RecordType(),
+				UUID:     record.UUID,
+				OldValue: record.Value(),
+				Owner:    tag.Owner,
+				Reason:   "not in records file",
+			},
+			apply: func(ctx context.Context) error { return client.Unbound.DeleteHostOverride(ctx, record) },
+		})
+	}
+
+	return ops, nil
+}
+
+// syncDiff returns the names of the fields in which existing differs from the
+// desired record.
+func syncDiff(existing, desired *opnsense.HostOverride) []string {
+	var diff []string
+	if !existing.EqualValue(desired.Value()) {
+		diff = append(diff, "value")
+	}
+	if existing.Description != desired.Description {
+		diff = append(diff, "description")
+	}
+	if existing.Enabled != desired.Enabled {
+		diff = append(diff, "enabled")
+	}
+	return diff
+}
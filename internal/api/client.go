@@ -4,34 +4,103 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 
 	"opnsense-auto-dns/internal/logger"
 
 	"github.com/go-resty/resty/v2"
 )
 
+const defaultRetryWait = time.Second
+
+// Options configure how the client talks to the API.
+type Options struct {
+	// TLS is the configuration built by NewTLSConfig, nil for the defaults.
+	TLS *tls.Config
+	// Retries is the number of times a request failing with a transient
+	// error is retried, waiting RetryWait (default 1s) before the first retry
+	// and doubling the wait after every further attempt.
+	Retries   int
+	RetryWait time.Duration
+	// Timeout bounds every single request, including reading the response.
+	Timeout time.Duration
+}
+
 type Client struct {
-	host      string
+	baseURL   string
 	apiKey    string
 	apiSecret string
 	resty     *resty.Client
+	retries   int
+	retryWait time.Duration
 }
 
-func NewClient(host, apiKey, apiSecret string, ignoreCert bool) *Client {
-	logger.Info("Creating new API client", "host", host, "ignoreCert", ignoreCert)
+// ParseBaseURL validates the address of the API and returns it as a base URL
+// without trailing slash that endpoints are appended to. The address is a URL
+// with http or https scheme, host, optional port and optional path prefix,
+// or a bare host (and port) for https.
+func ParseBaseURL(address string) (string, error) {
+	if !strings.Contains(address, "://") {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+			address = "[" + address + "]"
+		}
+		address = "https://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q, expected http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("%q has no host", address)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%q must not contain credentials, a query or a fragment", address)
+	}
+	if port := u.Port(); port != "" {
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// NewClient returns a client of the API at baseURL, as returned by
+// ParseBaseURL.
+func NewClient(baseURL, apiKey, apiSecret string, options Options) *Client {
+	logger.Info("Creating new API client", "url", baseURL, "retries", options.Retries)
 
 	restyClient := resty.New()
 
-	if ignoreCert {
-		logger.Warn("TLS certificate verification disabled")
-		restyClient.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	if options.TLS != nil {
+		restyClient.SetTLSClientConfig(options.TLS)
+	}
+
+	if options.Timeout > 0 {
+		restyClient.SetTimeout(options.Timeout)
+	}
+
+	retryWait := options.RetryWait
+	if retryWait <= 0 {
+		retryWait = defaultRetryWait
 	}
 
 	return &Client{
-		host:      host,
+		baseURL:   baseURL,
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
 		resty:     restyClient,
+		retries:   options.Retries,
+		retryWait: retryWait,
 	}
 }
 
@@ -45,10 +114,18 @@ func (c *Client) GetRestyClient() *resty.Client {
 	return c.resty
 }
 
-func (c *Client) GetHost() string {
-	return c.host
+func (c *Client) GetBaseURL() string {
+	return c.baseURL
 }
 
 func (c *Client) GetAuthHeader() string {
 	return c.getAuthHeader()
 }
+
+func (c *Client) GetRetries() int {
+	return c.retries
+}
+
+func (c *Client) GetRetryWait() time.Duration {
+	return c.retryWait
+}
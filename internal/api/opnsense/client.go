@@ -1,21 +1,260 @@
 package opnsense
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
 	"opnsense-auto-dns/internal/api"
+	"opnsense-auto-dns/internal/logger"
+)
+
+const (
+	searchPageSize = 500
+	maxRetryWait   = 30 * time.Second
 )
 
+// Backends host overrides can be written to.
+const (
+	BackendUnbound = "unbound"
+	BackendDnsmasq = "dnsmasq"
+)
+
+// RecordService is implemented by the services that manage host overrides.
+type RecordService interface {
+	SearchHostOverrides(ctx context.Context, searchPhrase string) ([]HostOverride, error)
+	CreateHostOverride(ctx context.Context, record *HostOverride) error
+	UpdateHostOverride(ctx context.Context, record *HostOverride) error
+	DeleteHostOverride(ctx context.Context, record *HostOverride) error
+	ReconfigureService(ctx context.Context) error
+}
+
 type Client struct {
 	*api.Client
-	Unbound *UnboundService
+	Unbound  *UnboundService
+	Forwards *ForwardService
+	Dnsmasq  *DnsmasqService
+	Kea      *KeaService
+
+	FirewallAlias *FirewallAliasService
 }
 
-func NewClient(host, apiKey, apiSecret string, ignoreCert bool) *Client {
-	baseClient := api.NewClient(host, apiKey, apiSecret, ignoreCert)
+func NewClient(baseURL, apiKey, apiSecret string, options api.Options) *Client {
+	baseClient := api.NewClient(baseURL, apiKey, apiSecret, options)
 
 	client := &Client{
 		Client: baseClient,
 	}
 
 	client.Unbound = NewUnboundService(client)
+	client.Forwards = NewForwardService(client)
+	client.Dnsmasq = NewDnsmasqService(client)
+	client.Kea = NewKeaService(client)
+	client.FirewallAlias = NewFirewallAliasService(client)
 	return client
 }
+
+// Records returns the service managing the host overrides of backend.
+func (c *Client) Records(backend string) (RecordService, error) {
+	switch backend {
+	case BackendUnbound, "":
+		return c.Unbound, nil
+	case BackendDnsmasq:
+		return c.Dnsmasq, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q (expected %s or %s)", backend, BackendUnbound, BackendDnsmasq)
+}
+
+// makeAPIRequest sends a request to the API, retrying transient failures
+// (connection errors, timeouts, 5xx and 429 responses) with jittered
+// exponential backoff. Requests adding or deleting an entry are not
+// idempotent, as a timed out or failed attempt may have been applied already
+// and its retry would add a duplicate or report the entry as not found; they
+// are only retried when the firewall cannot have processed them.
+func (c *Client) makeAPIRequest(ctx context.Context, method, endpoint string, payload any) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := c.doAPIRequest(ctx, method, endpoint, payload)
+		if err == nil || attempt >= c.GetRetries() || ctx.Err() != nil || !isTransient(err) {
+			return body, err
+		}
+		if !isIdempotent(endpoint) && !notProcessed(err) {
+			return body, err
+		}
+
+		delay := retryDelay(c.GetRetryWait(), attempt)
+		logger.Warn("API request failed, retrying", "method", method, "endpoint", endpoint, "attempt", attempt+1, "retry_in", delay, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return body, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay returns the wait before retry attempt+1: wait doubled per
+// attempt up to maxRetryWait, of which a random half is skipped so that
+// clients failing together do not retry together.
+func retryDelay(wait time.Duration, attempt int) time.Duration {
+	delay := maxRetryWait
+	if attempt < 16 && wait<<attempt < maxRetryWait {
+		delay = wait << attempt
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isIdempotent reports whether endpoint can be retried after an attempt that
+// may have been applied. Endpoints adding or deleting an entry, like
+// addHostOverride or del_reservation/{uuid}, cannot. The action is the segment
+// after /api/{module}/{controller}, so UUIDs and other parameters following it
+// do not count.
+func isIdempotent(endpoint string) bool {
+	segments := strings.Split(strings.TrimPrefix(endpoint, "/"), "/")
+	if len(segments) < 4 {
+		return true
+	}
+	action := segments[3]
+	return !strings.HasPrefix(action, "add") && !strings.HasPrefix(action, "del")
+}
+
+// notProcessed reports whether err shows that a request did not reach the
+// firewall or was rejected before being processed.
+func notProcessed(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	var opErr *net.OpError
+	return errors.Is(err, syscall.ECONNREFUSED) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+func isTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *Client) doAPIRequest(ctx context.Context, method, endpoint string, payload any) ([]byte, error) {
+	url := c.GetBaseURL() + endpoint
+	logger.Debug("Making API request", "method", method, "url", url)
+
+	req := c.GetRestyClient().R().
+		SetContext(ctx).
+		SetHeader("Authorization", c.GetAuthHeader())
+
+	if payload != nil {
+		req.SetHeader("Content-Type", "application/json").
+			SetBody(payload)
+	}
+
+	var resp *resty.Response
+	var err error
+
+	switch method {
+	case "GET":
+		resp, err = req.Get(url)
+	case "POST":
+		resp, err = req.Post(url)
+	default:
+		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := resp.Body()
+	logger.Debug("Received API response", "status", resp.StatusCode(), "body_length", len(body))
+
+	if resp.StatusCode() != http.StatusOK {
+		return body, &APIError{StatusCode: resp.StatusCode(), Body: string(body)}
+	}
+
+	return body, nil
+}
+
+func parseAPIResponse(body []byte, operation string) (*Response, error) {
+	var apiResponse Response
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		logger.Error("Failed to parse API response", "error", err, "response_body", string(body), "operation", operation)
+		return nil, fmt.Errorf("failed to parse API response: %w", err)
+	}
+
+	if apiResponse.Result == "failed" {
+		logger.Error("API operation failed", "result", apiResponse.Result, "response", string(body), "operation", operation)
+		if len(apiResponse.Validations) > 0 {
+			return nil, newValidationError(apiResponse.Validations)
+		}
+		return nil, fmt.Errorf("API operation failed: %s", string(body))
+	}
+
+	return &apiResponse, nil
+}
+
+func parseDeleteResponse(body []byte, operation string) error {
+	var apiResponse Response
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		logger.Error("Failed to parse API response", "error", err, "response_body", string(body), "operation", operation)
+		return fmt.Errorf("failed to parse API response: %w", err)
+	}
+
+	if apiResponse.Result != "deleted" {
+		logger.Error("API operation failed", "result", apiResponse.Result, "response", string(body), "operation", operation)
+		if apiResponse.Result == "not found" {
+			return fmt.Errorf("%w: %s", ErrNotFound, string(body))
+		}
+		return fmt.Errorf("API operation failed: %s", string(body))
+	}
+
+	return nil
+}
+
+// searchAll fetches every row of a search endpoint matching searchPhrase,
+// following its pages.
+func searchAll[T any](ctx context.Context, c *Client, endpoint, searchPhrase string) ([]T, error) {
+	var rows []T
+	for page := 1; ; page++ {
+		payload := map[string]any{
+			"current":      page,
+			"rowCount":     searchPageSize,
+			"searchPhrase": searchPhrase,
+		}
+
+		body, err := c.makeAPIRequest(ctx, "POST", endpoint, payload)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+
+		var searchResponse SearchResponse[T]
+		if err := json.Unmarshal(body, &searchResponse); err != nil {
+			logger.Error("Failed to parse search response", "error", err, "endpoint", endpoint, "response_body", string(body))
+			return nil, fmt.Errorf("failed to parse search response: %w", err)
+		}
+
+		rows = append(rows, searchResponse.Rows...)
+		logger.Debug("Parsed search response", "endpoint", endpoint, "page", page, "row_count", len(searchResponse.Rows), "total", searchResponse.Total)
+
+		// Not every endpoint reports a total, so a missing or zero one only
+		// leaves the short page to end the search.
+		if len(searchResponse.Rows) < searchPageSize || (searchResponse.Total > 0 && len(rows) >= searchResponse.Total) {
+			break
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,172 @@
+package opnsense
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"opnsense-auto-dns/internal/api"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		wait    time.Duration
+		attempt int
+		max     time.Duration
+	}{
+		{wait: time.Second, attempt: 0, max: time.Second},
+		{wait: time.Second, attempt: 1, max: 2 * time.Second},
+		{wait: time.Second, attempt: 3, max: 8 * time.Second},
+		{wait: time.Second, attempt: 5, max: maxRetryWait},
+		{wait: time.Second, attempt: 40, max: maxRetryWait},
+		{wait: time.Hour, attempt: 0, max: maxRetryWait},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s attempt %d", tt.wait, tt.attempt), func(t *testing.T) {
+			for range 100 {
+				delay := retryDelay(tt.wait, tt.attempt)
+				if delay < tt.max/2 || delay > tt.max {
+					t.Fatalf("retryDelay(%s, %d) = %s, want between %s and %s", tt.wait, tt.attempt, delay, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "too many requests", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "bad gateway", err: fmt.Errorf("search: %w", &APIError{StatusCode: http.StatusBadGateway}), want: true},
+		{name: "unauthorized", err: &APIError{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "not found", err: &APIError{StatusCode: http.StatusNotFound}, want: false},
+		{name: "validation", err: &ValidationError{Fields: map[string]string{"host.hostname": "required"}}, want: false},
+		{name: "connection refused", err: fmt.Errorf("post: %w", syscall.ECONNREFUSED), want: true},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, want: true},
+		{name: "other", err: errors.New("tls: bad certificate"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{endpoint: "/api/unbound/settings/addHostOverride", want: false},
+		{endpoint: "/api/kea/dhcpv4/add_reservation", want: false},
+		{endpoint: "/api/dnsmasq/settings/add_host", want: false},
+		{endpoint: "/api/unbound/settings/setHostOverride/0f1e", want: true},
+		{endpoint: "/api/unbound/settings/setHostOverride/add0f1e", want: true},
+		{endpoint: "/api/unbound/settings/setHostAlias/del-1", want: true},
+		{endpoint: "/api/kea/dhcpv4/set_reservation/addb-0f1e", want: true},
+		{endpoint: "/api/firewall/alias/getAliasUUID/delegated", want: true},
+		{endpoint: "/api/unbound/settings/delHostOverride/0f1e", want: false},
+		{endpoint: "/api/kea/dhcpv4/del_reservation/0f1e", want: false},
+		{endpoint: "/api/unbound/settings/searchHostOverride", want: true},
+		{endpoint: "/api/unbound/service/reconfigure", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if got := isIdempotent(tt.endpoint); got != tt.want {
+				t.Errorf("isIdempotent(%q) = %v, want %v", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotProcessed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "too many requests", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "bad gateway", err: &APIError{StatusCode: http.StatusBadGateway}, want: false},
+		{name: "connection refused", err: fmt.Errorf("post: %w", syscall.ECONNREFUSED), want: true},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Err: errors.New("i/o timeout")}, want: true},
+		{name: "read timeout", err: &net.OpError{Op: "read", Err: errors.New("i/o timeout")}, want: false},
+		{name: "connection reset", err: syscall.ECONNRESET, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notProcessed(tt.err); got != tt.want {
+				t.Errorf("notProcessed(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  int
+		total bool
+	}{
+		{name: "single page", rows: 3, total: true},
+		{name: "several pages", rows: 2*searchPageSize + 7, total: true},
+		{name: "full last page", rows: 2 * searchPageSize, total: true},
+		{name: "several pages without total", rows: 2*searchPageSize + 7},
+		{name: "full last page without total", rows: 2 * searchPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				var payload struct {
+					Current  int `json:"current"`
+					RowCount int `json:"rowCount"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("invalid search payload: %v", err)
+				}
+
+				response := map[string]any{"current": payload.Current, "rows": []HostOverride{}}
+				for i := (payload.Current - 1) * payload.RowCount; i < min(payload.Current*payload.RowCount, tt.rows); i++ {
+					response["rows"] = append(response["rows"].([]HostOverride), HostOverride{UUID: fmt.Sprint(i)})
+				}
+				if tt.total {
+					response["total"] = tt.rows
+				}
+				json.NewEncoder(w).Encode(response)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "key", "secret", api.Options{})
+			rows, err := searchAll[HostOverride](context.Background(), client, "/api/unbound/settings/searchHostOverride", "")
+			if err != nil {
+				t.Fatalf("searchAll failed: %v", err)
+			}
+			if len(rows) != tt.rows {
+				t.Errorf("searchAll returned %d rows, want %d", len(rows), tt.rows)
+			}
+			if want := tt.rows/searchPageSize + 1; requests > want {
+				t.Errorf("searchAll sent %d requests, want at most %d", requests, want)
+			}
+		})
+	}
+}
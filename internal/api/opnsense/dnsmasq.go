@@ -0,0 +1,165 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// DnsmasqService manages the host entries of Dnsmasq as host overrides. Dnsmasq
+// hosts have no record type or enabled state: the type follows from the
+// address, only A and AAAA are supported and entries are always enabled.
+type DnsmasqService struct {
+	client *Client
+}
+
+func NewDnsmasqService(client *Client) *DnsmasqService {
+	return &DnsmasqService{
+		client: client,
+	}
+}
+
+// dnsmasqHost is a host entry as reported by the Dnsmasq search endpoint. IP
+// may hold several comma separated addresses.
+type dnsmasqHost struct {
+	UUID   string `json:"uuid"`
+	Host   string `json:"host"`
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+	Descr  string `json:"descr"`
+}
+
+// hostOverride converts the entry to a host override. The record type follows
+// from the first address; entries with several addresses keep all of them in
+// Server, see HostOverride.MultiAddress.
+func (h dnsmasqHost) hostOverride() HostOverride {
+	first, _, _ := strings.Cut(h.IP, ",")
+	rr := RecordTypeA
+	if parsed := net.ParseIP(strings.TrimSpace(first)); parsed != nil && parsed.To4() == nil {
+		rr = RecordTypeAAAA
+	}
+
+	return HostOverride{
+		UUID:        h.UUID,
+		Hostname:    h.Host,
+		Domain:      h.Domain,
+		RR:          rr,
+		Server:      strings.TrimSpace(h.IP),
+		Description: h.Descr,
+		Enabled:     "1",
+	}
+}
+
+func (s *DnsmasqService) createHostPayload(record *HostOverride) (map[string]any, error) {
+	if rr := record.RecordType(); rr != RecordTypeA && rr != RecordTypeAAAA {
+		return nil, fmt.Errorf("dnsmasq hosts do not support %s records", rr)
+	}
+
+	return map[string]any{"host": map[string]any{
+		"host":   record.Hostname,
+		"domain": record.Domain,
+		"ip":     record.Server,
+		"descr":  record.Description,
+	}}, nil
+}
+
+// SearchHostOverrides fetches all Dnsmasq hosts matching searchPhrase (all
+// hosts when empty).
+func (s *DnsmasqService) SearchHostOverrides(ctx context.Context, searchPhrase string) ([]HostOverride, error) {
+	hosts, err := searchAll[dnsmasqHost](ctx, s.client, "/api/dnsmasq/settings/search_host", searchPhrase)
+	if err != nil {
+		logger.Error("Failed to fetch dnsmasq hosts", "error", err)
+		return nil, fmt.Errorf("failed to fetch dnsmasq hosts: %w", err)
+	}
+
+	records := make([]HostOverride, 0, len(hosts))
+	for _, host := range hosts {
+		records = append(records, host.hostOverride())
+	}
+	return records, nil
+}
+
+func (s *DnsmasqService) CreateHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Creating new dnsmasq host", "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
+
+	payload, err := s.createHostPayload(record)
+	if err != nil {
+		return err
+	}
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/dnsmasq/settings/add_host", payload)
+	if err != nil {
+		logger.Error("Failed to create dnsmasq host", "error", err, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+		return fmt.Errorf("error creating dnsmasq host: %w", err)
+	}
+
+	apiResponse, err := parseAPIResponse(body, "create dnsmasq host")
+	if err != nil {
+		return err
+	}
+	record.UUID = apiResponse.UUID
+
+	logger.Info("Successfully created dnsmasq host", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+	return nil
+}
+
+func (s *DnsmasqService) UpdateHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Updating existing dnsmasq host", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
+
+	payload, err := s.createHostPayload(record)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("/api/dnsmasq/settings/set_host/%s", record.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, payload)
+	if err != nil {
+		logger.Error("Failed to update dnsmasq host", "error", err, "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+		return fmt.Errorf("error updating dnsmasq host: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "update dnsmasq host"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully updated dnsmasq host", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+	return nil
+}
+
+func (s *DnsmasqService) DeleteHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Deleting dnsmasq host", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType())
+
+	endpoint := fmt.Sprintf("/api/dnsmasq/settings/del_host/%s", record.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, map[string]any{})
+	if err != nil {
+		logger.Error("Failed to delete dnsmasq host", "error", err, "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain)
+		return fmt.Errorf("error deleting dnsmasq host: %w", err)
+	}
+
+	if err := parseDeleteResponse(body, "delete dnsmasq host"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully deleted dnsmasq host", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain)
+	return nil
+}
+
+func (s *DnsmasqService) ReconfigureService(ctx context.Context) error {
+	logger.Info("Reconfiguring dnsmasq service")
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/dnsmasq/service/reconfigure", map[string]any{})
+	if err != nil {
+		logger.Error("Failed to reconfigure dnsmasq service", "error", err)
+		return fmt.Errorf("failed to reconfigure dnsmasq service: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "reconfigure service"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully reconfigured dnsmasq service")
+	return nil
+}
@@ -0,0 +1,85 @@
+package opnsense
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Errors callers can test for with errors.Is.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// APIError is returned for responses with a status other than 200. It matches
+// ErrUnauthorized, ErrForbidden and ErrNotFound by status code.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed, status: %d, response: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed when retried.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// ValidationError is returned when OPNsense rejects an item it was asked to
+// save. Fields maps the invalid fields ("host.hostname") to their messages.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, message := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, message))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(fields, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// newValidationError converts the validations of a failed response, whose
+// messages are strings or lists of strings.
+func newValidationError(validations map[string]any) *ValidationError {
+	fields := make(map[string]string, len(validations))
+	for field, message := range validations {
+		switch m := message.(type) {
+		case string:
+			fields[field] = m
+		case []any:
+			var messages []string
+			for _, item := range m {
+				messages = append(messages, fmt.Sprint(item))
+			}
+			fields[field] = strings.Join(messages, ", ")
+		default:
+			fields[field] = fmt.Sprint(m)
+		}
+	}
+	return &ValidationError{Fields: fields}
+}
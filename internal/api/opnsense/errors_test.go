@@ -0,0 +1,45 @@
+package opnsense
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{status: http.StatusUnauthorized, target: ErrUnauthorized},
+		{status: http.StatusForbidden, target: ErrForbidden},
+		{status: http.StatusNotFound, target: ErrNotFound},
+		{status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := error(&APIError{StatusCode: tt.status})
+			for _, target := range []error{ErrUnauthorized, ErrForbidden, ErrNotFound, ErrValidation} {
+				if got, want := errors.Is(err, target), target == tt.target; got != want {
+					t.Errorf("errors.Is(%d, %v) = %v, want %v", tt.status, target, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewValidationError(t *testing.T) {
+	err := newValidationError(map[string]any{
+		"host.hostname": "A hostname is required.",
+		"host.server":   []any{"Invalid address.", "Required."},
+	})
+
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("errors.Is(%v, ErrValidation) = false", err)
+	}
+	want := "validation failed: host.hostname: A hostname is required.; host.server: Invalid address., Required."
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,105 @@
+package opnsense
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// FirewallAliasService manages the content of firewall aliases.
+type FirewallAliasService struct {
+	client *Client
+}
+
+func NewFirewallAliasService(client *Client) *FirewallAliasService {
+	return &FirewallAliasService{
+		client: client,
+	}
+}
+
+// GetAlias fetches the firewall alias called name.
+func (s *FirewallAliasService) GetAlias(ctx context.Context, name string) (*FirewallAlias, error) {
+	body, err := s.client.makeAPIRequest(ctx, "GET", "/api/firewall/alias/getAliasUUID/"+url.PathEscape(name), nil)
+	if err != nil {
+		logger.Error("Failed to look up firewall alias", "error", err, "name", name)
+		return nil, fmt.Errorf("error looking up firewall alias %q: %w", name, err)
+	}
+
+	// An unknown alias is reported as an empty array instead of an object.
+	var lookup struct {
+		UUID string `json:"uuid"`
+	}
+	if err := json.Unmarshal(body, &lookup); err != nil || lookup.UUID == "" {
+		return nil, fmt.Errorf("firewall alias %q: %w", name, ErrNotFound)
+	}
+
+	body, err = s.client.makeAPIRequest(ctx, "GET", "/api/firewall/alias/getItem/"+lookup.UUID, nil)
+	if err != nil {
+		logger.Error("Failed to fetch firewall alias", "error", err, "name", name, "uuid", lookup.UUID)
+		return nil, fmt.Errorf("error fetching firewall alias %q: %w", name, err)
+	}
+
+	var item aliasItemResponse
+	if err := json.Unmarshal(body, &item); err != nil {
+		logger.Error("Failed to parse firewall alias", "error", err, "response_body", string(body))
+		return nil, fmt.Errorf("failed to parse firewall alias: %w", err)
+	}
+
+	alias := &FirewallAlias{
+		UUID:        lookup.UUID,
+		Name:        item.Alias.Name,
+		Description: item.Alias.Description,
+		Content:     item.Alias.Content.selected(),
+	}
+	if types := item.Alias.Type.selected(); len(types) > 0 {
+		alias.Type = types[0]
+	}
+
+	logger.Debug("Fetched firewall alias", "name", alias.Name, "uuid", alias.UUID, "type", alias.Type, "content", alias.Content)
+	return alias, nil
+}
+
+// SetAliasContent replaces the content and description of alias. The change
+// takes effect after Reconfigure.
+func (s *FirewallAliasService) SetAliasContent(ctx context.Context, alias *FirewallAlias) error {
+	logger.Info("Updating firewall alias", "name", alias.Name, "uuid", alias.UUID, "content", alias.Content)
+
+	endpoint := fmt.Sprintf("/api/firewall/alias/setItem/%s", alias.UUID)
+	payload := map[string]any{"alias": map[string]any{
+		"content":     strings.Join(alias.Content, "\n"),
+		"description": alias.Description,
+	}}
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, payload)
+	if err != nil {
+		logger.Error("Failed to update firewall alias", "error", err, "name", alias.Name, "uuid", alias.UUID)
+		return fmt.Errorf("error updating firewall alias: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "update firewall alias"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully updated firewall alias", "name", alias.Name, "uuid", alias.UUID)
+	return nil
+}
+
+func (s *FirewallAliasService) Reconfigure(ctx context.Context) error {
+	logger.Info("Reconfiguring firewall aliases")
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/firewall/alias/reconfigure", map[string]any{})
+	if err != nil {
+		logger.Error("Failed to reconfigure firewall aliases", "error", err)
+		return fmt.Errorf("failed to reconfigure firewall aliases: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "reconfigure firewall aliases"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully reconfigured firewall aliases")
+	return nil
+}
@@ -0,0 +1,125 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// ForwardService manages the Unbound domain overrides (query forwarding
+// entries). Changes take effect after the Unbound service is reconfigured.
+type ForwardService struct {
+	client *Client
+}
+
+func NewForwardService(client *Client) *ForwardService {
+	return &ForwardService{
+		client: client,
+	}
+}
+
+// forwardEndpoint returns the endpoint of action (search, add, set or del) for
+// entries of forwardType. OPNsense serves plain forwards and DNS over TLS
+// entries through separate endpoints, each scoped to its own type.
+func forwardEndpoint(action, forwardType string) string {
+	if forwardType == ForwardTypeDoT {
+		return "/api/unbound/settings/" + action + "Dot"
+	}
+	return "/api/unbound/settings/" + action + "Forward"
+}
+
+func (s *ForwardService) createForwardPayload(forward *DomainOverride) map[string]any {
+	dot := map[string]any{
+		"type":        forward.ForwardType(),
+		"domain":      forward.Domain,
+		"server":      forward.Server,
+		"port":        forward.Port,
+		"verify":      forward.Verify,
+		"description": forward.Description,
+	}
+
+	if forward.Enabled != "" {
+		dot["enabled"] = forward.Enabled
+	}
+
+	return map[string]any{"dot": dot}
+}
+
+// SearchDomainOverrides fetches all query forwarding entries, plain forwards
+// and DNS over TLS, matching searchPhrase (all entries when empty).
+func (s *ForwardService) SearchDomainOverrides(ctx context.Context, searchPhrase string) ([]DomainOverride, error) {
+	var forwards []DomainOverride
+	seen := make(map[string]bool)
+	for _, forwardType := range []string{ForwardTypeDoT, ForwardTypeForward} {
+		rows, err := searchAll[DomainOverride](ctx, s.client, forwardEndpoint("search", forwardType), searchPhrase)
+		if err != nil {
+			logger.Error("Failed to fetch domain overrides", "error", err, "type", forwardType)
+			return nil, fmt.Errorf("failed to fetch %s domain overrides: %w", forwardType, err)
+		}
+		for _, row := range rows {
+			if seen[row.UUID] {
+				continue
+			}
+			seen[row.UUID] = true
+			row.Type = forwardType
+			forwards = append(forwards, row)
+		}
+	}
+	return forwards, nil
+}
+
+func (s *ForwardService) CreateDomainOverride(ctx context.Context, forward *DomainOverride) error {
+	logger.Info("Creating domain override", "domain", forward.Domain, "server", forward.Target(), "type", forward.ForwardType())
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", forwardEndpoint("add", forward.ForwardType()), s.createForwardPayload(forward))
+	if err != nil {
+		logger.Error("Failed to create domain override", "error", err, "domain", forward.Domain, "server", forward.Target())
+		return fmt.Errorf("error creating domain override: %w", err)
+	}
+
+	apiResponse, err := parseAPIResponse(body, "create domain override")
+	if err != nil {
+		return err
+	}
+	forward.UUID = apiResponse.UUID
+
+	logger.Info("Successfully created domain override", "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target())
+	return nil
+}
+
+func (s *ForwardService) UpdateDomainOverride(ctx context.Context, forward *DomainOverride) error {
+	logger.Info("Updating domain override", "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target(), "type", forward.ForwardType())
+
+	endpoint := fmt.Sprintf("%s/%s", forwardEndpoint("set", forward.ForwardType()), forward.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, s.createForwardPayload(forward))
+	if err != nil {
+		logger.Error("Failed to update domain override", "error", err, "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target())
+		return fmt.Errorf("error updating domain override: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "update domain override"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully updated domain override", "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target())
+	return nil
+}
+
+func (s *ForwardService) DeleteDomainOverride(ctx context.Context, forward *DomainOverride) error {
+	logger.Info("Deleting domain override", "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target())
+
+	endpoint := fmt.Sprintf("%s/%s", forwardEndpoint("del", forward.ForwardType()), forward.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, map[string]any{})
+	if err != nil {
+		logger.Error("Failed to delete domain override", "error", err, "uuid", forward.UUID, "domain", forward.Domain)
+		return fmt.Errorf("error deleting domain override: %w", err)
+	}
+
+	if err := parseDeleteResponse(body, "delete domain override"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully deleted domain override", "uuid", forward.UUID, "domain", forward.Domain, "server", forward.Target())
+	return nil
+}
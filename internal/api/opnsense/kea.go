@@ -0,0 +1,119 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// KeaService manages the static reservations of the Kea DHCPv4 server.
+type KeaService struct {
+	client *Client
+}
+
+func NewKeaService(client *Client) *KeaService {
+	return &KeaService{
+		client: client,
+	}
+}
+
+func (s *KeaService) createReservationPayload(reservation *KeaReservation) map[string]any {
+	return map[string]any{"reservation": map[string]any{
+		"subnet":      reservation.Subnet,
+		"ip_address":  reservation.IPAddress,
+		"hw_address":  reservation.HWAddress,
+		"hostname":    reservation.Hostname,
+		"description": reservation.Description,
+	}}
+}
+
+func (s *KeaService) SearchSubnets(ctx context.Context, searchPhrase string) ([]KeaSubnet, error) {
+	subnets, err := searchAll[KeaSubnet](ctx, s.client, "/api/kea/dhcpv4/search_subnet", searchPhrase)
+	if err != nil {
+		logger.Error("Failed to fetch DHCP subnets", "error", err)
+		return nil, fmt.Errorf("failed to fetch DHCP subnets: %w", err)
+	}
+	return subnets, nil
+}
+
+func (s *KeaService) SearchReservations(ctx context.Context, searchPhrase string) ([]KeaReservation, error) {
+	reservations, err := searchAll[KeaReservation](ctx, s.client, "/api/kea/dhcpv4/search_reservation", searchPhrase)
+	if err != nil {
+		logger.Error("Failed to fetch DHCP reservations", "error", err)
+		return nil, fmt.Errorf("failed to fetch DHCP reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+func (s *KeaService) CreateReservation(ctx context.Context, reservation *KeaReservation) error {
+	logger.Info("Creating DHCP reservation", "hostname", reservation.Hostname, "ip", reservation.IPAddress, "mac", reservation.HWAddress)
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/kea/dhcpv4/add_reservation", s.createReservationPayload(reservation))
+	if err != nil {
+		logger.Error("Failed to create DHCP reservation", "error", err, "hostname", reservation.Hostname, "ip", reservation.IPAddress)
+		return fmt.Errorf("error creating DHCP reservation: %w", err)
+	}
+
+	apiResponse, err := parseAPIResponse(body, "create DHCP reservation")
+	if err != nil {
+		return err
+	}
+	reservation.UUID = apiResponse.UUID
+
+	logger.Info("Successfully created DHCP reservation", "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress, "mac", reservation.HWAddress)
+	return nil
+}
+
+func (s *KeaService) UpdateReservation(ctx context.Context, reservation *KeaReservation) error {
+	logger.Info("Updating DHCP reservation", "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress, "mac", reservation.HWAddress)
+
+	endpoint := fmt.Sprintf("/api/kea/dhcpv4/set_reservation/%s", reservation.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, s.createReservationPayload(reservation))
+	if err != nil {
+		logger.Error("Failed to update DHCP reservation", "error", err, "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress)
+		return fmt.Errorf("error updating DHCP reservation: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "update DHCP reservation"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully updated DHCP reservation", "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress)
+	return nil
+}
+
+func (s *KeaService) DeleteReservation(ctx context.Context, reservation *KeaReservation) error {
+	logger.Info("Deleting DHCP reservation", "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress)
+
+	endpoint := fmt.Sprintf("/api/kea/dhcpv4/del_reservation/%s", reservation.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, map[string]any{})
+	if err != nil {
+		logger.Error("Failed to delete DHCP reservation", "error", err, "uuid", reservation.UUID, "hostname", reservation.Hostname)
+		return fmt.Errorf("error deleting DHCP reservation: %w", err)
+	}
+
+	if err := parseDeleteResponse(body, "delete DHCP reservation"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully deleted DHCP reservation", "uuid", reservation.UUID, "hostname", reservation.Hostname, "ip", reservation.IPAddress)
+	return nil
+}
+
+func (s *KeaService) ReconfigureService(ctx context.Context) error {
+	logger.Info("Reconfiguring kea DHCP service")
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/kea/service/reconfigure", map[string]any{})
+	if err != nil {
+		logger.Error("Failed to reconfigure kea service", "error", err)
+		return fmt.Errorf("failed to reconfigure kea service: %w", err)
+	}
+
+	if _, err := parseAPIResponse(body, "reconfigure service"); err != nil {
+		return err
+	}
+
+	logger.Info("Successfully reconfigured kea DHCP service")
+	return nil
+}
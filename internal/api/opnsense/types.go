@@ -1,20 +1,282 @@
 package opnsense
 
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RecordTypeA    = "A"
+	RecordTypeAAAA = "AAAA"
+	RecordTypeMX   = "MX"
+	RecordTypeTXT  = "TXT"
+)
+
+// RecordTypes are the record types host overrides can hold.
+var RecordTypes = []string{RecordTypeA, RecordTypeAAAA, RecordTypeMX, RecordTypeTXT}
+
+const defaultMXPriority = "10"
+
 type HostOverride struct {
 	UUID        string `json:"uuid"`
 	Hostname    string `json:"hostname"`
 	Domain      string `json:"domain"`
+	RR          string `json:"rr"`
 	Server      string `json:"server"`
+	MXPrio      string `json:"mxprio"`
+	MX          string `json:"mx"`
+	TXTData     string `json:"txtdata"`
+	Description string `json:"description"`
+	Enabled     string `json:"enabled"`
+}
+
+// NewDNSRecord returns an override of type rr with the given value, see
+// SetValue.
+func NewDNSRecord(hostname, domain, rr, value string) *HostOverride {
+	record := &HostOverride{
+		Hostname:    hostname,
+		Domain:      domain,
+		RR:          rr,
+		Description: fmt.Sprintf("Auto-updated by opnsense-auto-dns at %s", time.Now().Format("2006-01-02 15:04:05")),
+	}
+	record.SetValue(value)
+	return record
+}
+
+// Value returns the data of the override in zone file notation: the address
+// for A and AAAA, "priority host" for MX and the text for TXT.
+func (h *HostOverride) Value() string {
+	switch h.RecordType() {
+	case RecordTypeMX:
+		return strings.TrimSpace(h.MXPrio + " " + h.MX)
+	case RecordTypeTXT:
+		return h.TXTData
+	default:
+		return h.Server
+	}
+}
+
+// SetValue sets the data fields of the override from a value in the notation
+// of Value. An MX value without a priority gets priority 10; a given priority,
+// including 0, is kept.
+func (h *HostOverride) SetValue(value string) {
+	switch h.RecordType() {
+	case RecordTypeMX:
+		value = strings.TrimSpace(value)
+		h.MXPrio, h.MX = defaultMXPriority, value
+		if prio, host, ok := strings.Cut(value, " "); ok {
+			h.MXPrio, h.MX = prio, strings.TrimSpace(host)
+		}
+	case RecordTypeTXT:
+		h.TXTData = value
+	default:
+		h.Server = value
+	}
+}
+
+// EqualValue reports whether the override holds value, comparing addresses of
+// A and AAAA records by IP rather than by notation.
+func (h *HostOverride) EqualValue(value string) bool {
+	current := h.Value()
+	if current == value {
+		return true
+	}
+	switch h.RecordType() {
+	case RecordTypeA, RecordTypeAAAA:
+		ip := net.ParseIP(current)
+		return ip != nil && ip.Equal(net.ParseIP(value))
+	case RecordTypeMX:
+		return strings.Join(strings.Fields(current), " ") == strings.Join(strings.Fields(value), " ")
+	default:
+		return false
+	}
+}
+
+// RecordType returns the bare record type of the override. The search endpoint
+// reports it with a description (e.g. "A (IPv4 address)") and overrides created
+// by older OPNsense releases may omit it entirely, in which case A is assumed.
+func (h *HostOverride) RecordType() string {
+	fields := strings.Fields(h.RR)
+	if len(fields) == 0 {
+		return RecordTypeA
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// MultiAddress reports whether the override holds several addresses, as a
+// Dnsmasq host entry can. Such entries are not managed by the agent.
+func (h *HostOverride) MultiAddress() bool {
+	return strings.Contains(h.Server, ",")
+}
+
+type RecordKey struct {
+	Hostname string
+	Domain   string
+	Type     string
+}
+
+func NewRecordKey(hostname, domain, rr string) RecordKey {
+	return RecordKey{
+		Hostname: strings.ToLower(hostname),
+		Domain:   strings.ToLower(domain),
+		Type:     strings.ToUpper(rr),
+	}
+}
+
+type HostOverrideIndex map[RecordKey]*HostOverride
+
+// NewHostOverrideIndex indexes records by hostname, domain and record type. When
+// several overrides share a key, the first one returned by the API wins.
+func NewHostOverrideIndex(records []HostOverride) HostOverrideIndex {
+	index := make(HostOverrideIndex, len(records))
+	for i := range records {
+		record := &records[i]
+		key := NewRecordKey(record.Hostname, record.Domain, record.RecordType())
+		if _, exists := index[key]; exists {
+			continue
+		}
+		index[key] = record
+	}
+	return index
+}
+
+func (idx HostOverrideIndex) Get(hostname, domain, rr string) *HostOverride {
+	return idx[NewRecordKey(hostname, domain, rr)]
+}
+
+// HostAlias is an additional name for a host override. Host refers to the
+// parent override; the search endpoint may report it by UUID or by its
+// display name ("hostname.domain").
+type HostAlias struct {
+	UUID        string `json:"uuid"`
+	Host        string `json:"host"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
 	Description string `json:"description"`
 	Enabled     string `json:"enabled"`
 }
 
-type SearchResponse struct {
-	Status string         `json:"status"`
-	Rows   []HostOverride `json:"rows"`
+// AttachedTo reports whether the alias belongs to record.
+func (a *HostAlias) AttachedTo(record *HostOverride) bool {
+	return a.Host == record.UUID || strings.EqualFold(a.Host, record.Hostname+"."+record.Domain)
+}
+
+// Forward types of Unbound query forwarding entries.
+const (
+	ForwardTypeForward = "forward"
+	ForwardTypeDoT     = "dot"
+)
+
+// DomainOverride is an Unbound query forwarding entry (called a domain override
+// in older releases): queries for Domain are sent to Server. Verify is the
+// name the certificate of a DNS over TLS server is checked against.
+type DomainOverride struct {
+	UUID        string `json:"uuid"`
+	Enabled     string `json:"enabled"`
+	Type        string `json:"type"`
+	Domain      string `json:"domain"`
+	Server      string `json:"server"`
+	Port        string `json:"port"`
+	Verify      string `json:"verify"`
+	Description string `json:"description"`
+}
+
+// ForwardType returns the type of the entry; the search endpoint reports it by
+// its display text ("DNS over TLS").
+func (d *DomainOverride) ForwardType() string {
+	switch strings.ToLower(d.Type) {
+	case ForwardTypeDoT, "dns over tls":
+		return ForwardTypeDoT
+	}
+	return ForwardTypeForward
+}
+
+// Target returns the server and, when set, the port queries are forwarded to.
+func (d *DomainOverride) Target() string {
+	if d.Port == "" {
+		return d.Server
+	}
+	return net.JoinHostPort(d.Server, d.Port)
+}
+
+// KeaReservation is a static DHCPv4 lease. Subnet refers to a KeaSubnet; the
+// search endpoint may report it by UUID or by its prefix.
+type KeaReservation struct {
+	UUID        string `json:"uuid"`
+	Subnet      string `json:"subnet"`
+	IPAddress   string `json:"ip_address"`
+	HWAddress   string `json:"hw_address"`
+	Hostname    string `json:"hostname"`
+	Description string `json:"description"`
+}
+
+// InSubnet reports whether the reservation belongs to subnet.
+func (r *KeaReservation) InSubnet(subnet *KeaSubnet) bool {
+	return r.Subnet == subnet.UUID || r.Subnet == subnet.Subnet
+}
+
+type KeaSubnet struct {
+	UUID        string `json:"uuid"`
+	Subnet      string `json:"subnet"`
+	Description string `json:"description"`
+}
+
+// Contains reports whether ip lies in the prefix of the subnet.
+func (s *KeaSubnet) Contains(ip net.IP) bool {
+	_, network, err := net.ParseCIDR(s.Subnet)
+	return err == nil && network.Contains(ip)
+}
+
+// FirewallAlias is a firewall alias with the entries of its content.
+type FirewallAlias struct {
+	UUID        string
+	Name        string
+	Type        string
+	Description string
+	Content     []string
+}
+
+// aliasOptions is how the alias item endpoint reports option fields: every
+// possible value keyed by itself, with the chosen ones selected.
+type aliasOptions map[string]struct {
+	Value    string `json:"value"`
+	Selected int    `json:"selected"`
+}
+
+func (o aliasOptions) selected() []string {
+	var values []string
+	for key, option := range o {
+		if option.Selected == 1 {
+			values = append(values, key)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+type aliasItemResponse struct {
+	Alias struct {
+		Name        string       `json:"name"`
+		Type        aliasOptions `json:"type"`
+		Description string       `json:"description"`
+		Content     aliasOptions `json:"content"`
+	} `json:"alias"`
+}
+
+type SearchResponse[T any] struct {
+	Status   string `json:"status"`
+	Rows     []T    `json:"rows"`
+	RowCount int    `json:"rowCount"`
+	Total    int    `json:"total"`
+	Current  int    `json:"current"`
 }
 
 type Response struct {
-	Status string `json:"status"`
-	Result string `json:"result"`
+	Status      string         `json:"status"`
+	Result      string         `json:"result"`
+	UUID        string         `json:"uuid,omitempty"`
+	Validations map[string]any `json:"validations,omitempty"`
 }
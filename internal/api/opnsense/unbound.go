@@ -1,15 +1,10 @@
 package opnsense
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
-	"strings"
-	"time"
 
 	"opnsense-auto-dns/internal/logger"
-
-	"github.com/go-resty/resty/v2"
 )
 
 type UnboundService struct {
@@ -22,170 +17,195 @@ func NewUnboundService(client *Client) *UnboundService {
 	}
 }
 
-func (s *UnboundService) makeAPIRequest(method, endpoint string, payload any) ([]byte, error) {
-	url := fmt.Sprintf("https://%s%s", s.client.GetHost(), endpoint)
-	logger.Debug("Making API request", "method", method, "url", url)
+func (s *UnboundService) createHostPayload(record *HostOverride) map[string]any {
+	host := map[string]any{
+		"hostname":    record.Hostname,
+		"domain":      record.Domain,
+		"rr":          record.RecordType(),
+		"description": record.Description,
+	}
 
-	req := s.client.GetRestyClient().R().
-		SetHeader("Authorization", s.client.GetAuthHeader())
+	switch record.RecordType() {
+	case RecordTypeMX:
+		host["mxprio"] = record.MXPrio
+		host["mx"] = record.MX
+	case RecordTypeTXT:
+		host["txtdata"] = record.TXTData
+	default:
+		host["server"] = record.Server
+	}
 
-	if payload != nil {
-		req.SetHeader("Content-Type", "application/json").
-			SetBody(payload)
+	if record.Enabled != "" {
+		host["enabled"] = record.Enabled
 	}
 
-	var resp *resty.Response
-	var err error
+	return map[string]any{"host": host}
+}
 
-	switch method {
-	case "GET":
-		resp, err = req.Get(url)
-	case "POST":
-		resp, err = req.Post(url)
-	default:
-		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
+// SearchHostOverrides fetches all host overrides matching searchPhrase (all
+// overrides when empty), following the pages of the search endpoint.
+func (s *UnboundService) SearchHostOverrides(ctx context.Context, searchPhrase string) ([]HostOverride, error) {
+	records, err := searchAll[HostOverride](ctx, s.client, "/api/unbound/settings/search_host_override", searchPhrase)
+	if err != nil {
+		logger.Error("Failed to fetch host overrides", "error", err)
+		return nil, fmt.Errorf("failed to fetch host overrides: %w", err)
 	}
+	return records, nil
+}
 
+func (s *UnboundService) SearchHostAliases(ctx context.Context, searchPhrase string) ([]HostAlias, error) {
+	aliases, err := searchAll[HostAlias](ctx, s.client, "/api/unbound/settings/search_host_alias", searchPhrase)
 	if err != nil {
-		return nil, err
+		logger.Error("Failed to fetch host aliases", "error", err)
+		return nil, fmt.Errorf("failed to fetch host aliases: %w", err)
 	}
+	return aliases, nil
+}
 
-	body := resp.Body()
-	logger.Debug("Received API response", "status", resp.StatusCode(), "body_length", len(body))
+func (s *UnboundService) CreateHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Creating new DNS record", "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
 
-	if resp.StatusCode() != http.StatusOK {
-		return body, fmt.Errorf("API request failed, status: %d, response: %s", resp.StatusCode(), string(body))
-	}
+	payload := s.createHostPayload(record)
 
-	return body, nil
-}
+	logger.Debug("Request payload", "payload", payload)
 
-func (s *UnboundService) parseAPIResponse(body []byte, operation string) error {
-	var apiResponse Response
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		logger.Error("Failed to parse API response", "error", err, "response_body", string(body), "operation", operation)
-		return fmt.Errorf("failed to parse API response: %v", err)
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/unbound/settings/addHostOverride", payload)
+	if err != nil {
+		logger.Error("Failed to create DNS record", "error", err, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+		return fmt.Errorf("error creating DNS: %w", err)
 	}
 
-	if apiResponse.Result == "failed" {
-		logger.Error("API operation failed", "result", apiResponse.Result, "response", string(body), "operation", operation)
-		return fmt.Errorf("API operation failed: %s", string(body))
+	apiResponse, err := parseAPIResponse(body, "create DNS record")
+	if err != nil {
+		return err
 	}
+	record.UUID = apiResponse.UUID
 
+	logger.Info("Successfully created DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
 	return nil
 }
 
-func (s *UnboundService) createHostPayload(hostname, domain, ip string, enabled string) map[string]any {
-	payload := map[string]any{
-		"host": map[string]any{
-			"hostname":    hostname,
-			"domain":      domain,
-			"rr":          "A",
-			"server":      ip,
-			"description": fmt.Sprintf("Auto-updated by opnsense-auto-dns at %s", time.Now().Format("2006-01-02 15:04:05")),
-		},
+func (s *UnboundService) UpdateHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Updating existing DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
+
+	endpoint := fmt.Sprintf("/api/unbound/settings/setHostOverride/%s", record.UUID)
+	payload := s.createHostPayload(record)
+
+	logger.Debug("Request payload", "payload", payload)
+
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, payload)
+	if err != nil {
+		logger.Error("Failed to update DNS record", "error", err, "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "value", record.Value())
+		return fmt.Errorf("error updating DNS: %w", err)
 	}
 
-	if enabled != "" {
-		payload["host"].(map[string]any)["enabled"] = enabled
+	if _, err := parseAPIResponse(body, "update DNS record"); err != nil {
+		return err
 	}
 
-	return payload
+	logger.Info("Successfully updated DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType(), "value", record.Value())
+	return nil
 }
 
-func (s *UnboundService) GetExistingDNSRecord(hostname, domain string) (*HostOverride, error) {
-	logger.Info("Searching for existing DNS record", "hostname", hostname, "domain", domain)
+func (s *UnboundService) DeleteHostOverride(ctx context.Context, record *HostOverride) error {
+	logger.Info("Deleting DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType())
+
+	endpoint := fmt.Sprintf("/api/unbound/settings/delHostOverride/%s", record.UUID)
 
-	body, err := s.makeAPIRequest("GET", "/api/unbound/settings/search_host_override", nil)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, map[string]any{})
 	if err != nil {
-		logger.Error("Failed to fetch existing DNS records", "error", err, "hostname", hostname, "domain", domain)
-		return nil, fmt.Errorf("failed to fetch existing DNS records: %v", err)
+		logger.Error("Failed to delete DNS record", "error", err, "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain)
+		return fmt.Errorf("error deleting DNS: %w", err)
 	}
 
-	var searchResponse SearchResponse
-	if err := json.Unmarshal(body, &searchResponse); err != nil {
-		logger.Error("Failed to parse DNS records response", "error", err, "response_body", string(body))
-		return nil, fmt.Errorf("failed to parse DNS records response: %v", err)
+	if err := parseDeleteResponse(body, "delete DNS record"); err != nil {
+		return err
 	}
 
-	logger.Debug("Parsed search response", "status", searchResponse.Status, "record_count", len(searchResponse.Rows))
+	logger.Info("Successfully deleted DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "rr", record.RecordType())
+	return nil
+}
 
-	for _, record := range searchResponse.Rows {
-		if strings.EqualFold(record.Hostname, hostname) && strings.EqualFold(record.Domain, domain) {
-			logger.Info("Found existing DNS record", "uuid", record.UUID, "hostname", record.Hostname, "domain", record.Domain, "server", record.Server)
-			return &record, nil
-		}
+func (s *UnboundService) createAliasPayload(alias *HostAlias) map[string]any {
+	payload := map[string]any{
+		"host":        alias.Host,
+		"hostname":    alias.Hostname,
+		"domain":      alias.Domain,
+		"description": alias.Description,
 	}
 
-	logger.Info("No existing DNS record found", "hostname", hostname, "domain", domain)
-	return nil, nil
-}
-
-func (s *UnboundService) UpdateDNSRecord(record *HostOverride, hostname, domain, ip string) error {
-	logger.Info("Updating existing DNS record", "uuid", record.UUID, "hostname", hostname, "domain", domain, "ip", ip)
+	if alias.Enabled != "" {
+		payload["enabled"] = alias.Enabled
+	}
 
-	endpoint := fmt.Sprintf("/api/unbound/settings/setHostOverride/%s", record.UUID)
-	payload := s.createHostPayload(hostname, domain, ip, "1")
+	return map[string]any{"alias": payload}
+}
 
-	logger.Debug("Request payload", "payload", payload)
+func (s *UnboundService) CreateHostAlias(ctx context.Context, alias *HostAlias) error {
+	logger.Info("Creating host alias", "hostname", alias.Hostname, "domain", alias.Domain, "host", alias.Host)
 
-	body, err := s.makeAPIRequest("POST", endpoint, payload)
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/unbound/settings/addHostAlias", s.createAliasPayload(alias))
 	if err != nil {
-		logger.Error("Failed to update DNS record", "error", err, "uuid", record.UUID, "hostname", hostname, "domain", domain, "ip", ip)
-		return fmt.Errorf("error updating DNS: %v", err)
+		logger.Error("Failed to create host alias", "error", err, "hostname", alias.Hostname, "domain", alias.Domain)
+		return fmt.Errorf("error creating host alias: %w", err)
 	}
 
-	if err := s.parseAPIResponse(body, "update DNS record"); err != nil {
+	apiResponse, err := parseAPIResponse(body, "create host alias")
+	if err != nil {
 		return err
 	}
+	alias.UUID = apiResponse.UUID
 
-	logger.Info("Successfully updated DNS record", "uuid", record.UUID, "hostname", hostname, "domain", domain, "ip", ip)
-
-	if err := s.ReconfigureService(); err != nil {
-		logger.Error("Failed to reconfigure unbound service after DNS update", "error", err)
-		return fmt.Errorf("DNS record updated but failed to reconfigure service: %v", err)
-	}
-
+	logger.Info("Successfully created host alias", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain, "host", alias.Host)
 	return nil
 }
 
-func (s *UnboundService) CreateDNSRecord(hostname, domain, ip string) error {
-	logger.Info("Creating new DNS record", "hostname", hostname, "domain", domain, "ip", ip)
-
-	payload := s.createHostPayload(hostname, domain, ip, "")
+func (s *UnboundService) UpdateHostAlias(ctx context.Context, alias *HostAlias) error {
+	logger.Info("Updating host alias", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain, "host", alias.Host)
 
-	logger.Debug("Request payload", "payload", payload)
-
-	body, err := s.makeAPIRequest("POST", "/api/unbound/settings/addHostOverride", payload)
+	endpoint := fmt.Sprintf("/api/unbound/settings/setHostAlias/%s", alias.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, s.createAliasPayload(alias))
 	if err != nil {
-		logger.Error("Failed to create DNS record", "error", err, "hostname", hostname, "domain", domain, "ip", ip)
-		return fmt.Errorf("error creating DNS: %v", err)
+		logger.Error("Failed to update host alias", "error", err, "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain)
+		return fmt.Errorf("error updating host alias: %w", err)
 	}
 
-	if err := s.parseAPIResponse(body, "create DNS record"); err != nil {
+	if _, err := parseAPIResponse(body, "update host alias"); err != nil {
 		return err
 	}
 
-	logger.Info("Successfully created DNS record", "hostname", hostname, "domain", domain, "ip", ip)
+	logger.Info("Successfully updated host alias", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain)
+	return nil
+}
+
+func (s *UnboundService) DeleteHostAlias(ctx context.Context, alias *HostAlias) error {
+	logger.Info("Deleting host alias", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain)
+
+	endpoint := fmt.Sprintf("/api/unbound/settings/delHostAlias/%s", alias.UUID)
+	body, err := s.client.makeAPIRequest(ctx, "POST", endpoint, map[string]any{})
+	if err != nil {
+		logger.Error("Failed to delete host alias", "error", err, "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain)
+		return fmt.Errorf("error deleting host alias: %w", err)
+	}
 
-	if err := s.ReconfigureService(); err != nil {
-		logger.Error("Failed to reconfigure unbound service after DNS creation", "error", err)
-		return fmt.Errorf("DNS record created but failed to reconfigure service: %v", err)
+	if err := parseDeleteResponse(body, "delete host alias"); err != nil {
+		return err
 	}
 
+	logger.Info("Successfully deleted host alias", "uuid", alias.UUID, "hostname", alias.Hostname, "domain", alias.Domain)
 	return nil
 }
 
-func (s *UnboundService) ReconfigureService() error {
+func (s *UnboundService) ReconfigureService(ctx context.Context) error {
 	logger.Info("Reconfiguring unbound DNS service")
 
-	body, err := s.makeAPIRequest("POST", "/api/unbound/service/reconfigure", map[string]any{})
+	body, err := s.client.makeAPIRequest(ctx, "POST", "/api/unbound/service/reconfigure", map[string]any{})
 	if err != nil {
 		logger.Error("Failed to reconfigure unbound service", "error", err)
-		return fmt.Errorf("failed to reconfigure unbound service: %v", err)
+		return fmt.Errorf("failed to reconfigure unbound service: %w", err)
 	}
 
-	if err := s.parseAPIResponse(body, "reconfigure service"); err != nil {
+	if _, err := parseAPIResponse(body, "reconfigure service"); err != nil {
 		return err
 	}
 
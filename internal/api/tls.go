@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// TLSOptions configure how the certificate of the firewall is verified.
+type TLSOptions struct {
+	IgnoreCert bool
+	// CAFile is a PEM bundle of the CAs to trust instead of the system pool.
+	CAFile string
+	// ServerName is the name the certificate is verified against (and sent
+	// via SNI) when it differs from the host connected to.
+	ServerName string
+	// CertSHA256 are SHA-256 fingerprints of the certificate in hex (colons
+	// optional), PubkeySHA256 base64 SHA-256 hashes of its public key
+	// (SubjectPublicKeyInfo). The certificate must match one of them.
+	CertSHA256   []string
+	PubkeySHA256 []string
+}
+
+// NewTLSConfig builds the TLS configuration for options. With pins but without
+// a CA file the chain is not verified, as the pin identifies the certificate;
+// a connection whose certificate matches no pin is refused, also with
+// IgnoreCert.
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{ServerName: options.ServerName}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file %s: %v", options.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	certPins, err := parsePins(options.CertSHA256, decodeHexPin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cert_sha256: %v", err)
+	}
+	pubkeyPins, err := parsePins(options.PubkeySHA256, decodeBase64Pin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey_sha256: %v", err)
+	}
+	pinned := len(certPins) > 0 || len(pubkeyPins) > 0
+
+	switch {
+	case options.IgnoreCert && !pinned:
+		logger.Warn("TLS certificate verification disabled")
+		config.InsecureSkipVerify = true
+	case options.IgnoreCert || (pinned && options.CAFile == ""):
+		config.InsecureSkipVerify = true
+	}
+
+	if pinned {
+		config.VerifyConnection = verifyPins(certPins, pubkeyPins)
+	}
+
+	return config, nil
+}
+
+func verifyPins(certPins, pubkeyPins [][]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		leaf := state.PeerCertificates[0]
+
+		certSum := sha256.Sum256(leaf.Raw)
+		pubkeySum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		for _, pin := range certPins {
+			if bytes.Equal(pin, certSum[:]) {
+				return nil
+			}
+		}
+		for _, pin := range pubkeyPins {
+			if bytes.Equal(pin, pubkeySum[:]) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("certificate matches no pin (cert_sha256 %s, pubkey_sha256 %s)", hex.EncodeToString(certSum[:]), base64.StdEncoding.EncodeToString(pubkeySum[:]))
+	}
+}
+
+func parsePins(pins []string, decode func(string) ([]byte, error)) ([][]byte, error) {
+	var parsed [][]byte
+	for _, pin := range pins {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		sum, err := decode(pin)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%q is not a SHA-256 hash", pin)
+		}
+		parsed = append(parsed, sum)
+	}
+	return parsed, nil
+}
+
+func decodeHexPin(pin string) ([]byte, error) {
+	return hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+}
+
+func decodeBase64Pin(pin string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256//"))
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "opnsense.lan"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return cert
+}
+
+func TestParsePins(t *testing.T) {
+	sum := sha256.Sum256([]byte("opnsense"))
+	hexPin := hex.EncodeToString(sum[:])
+	colonPin := strings.ToUpper(strings.Join(splitPairs(hexPin), ":"))
+	base64Pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		pins    []string
+		decode  func(string) ([]byte, error)
+		want    int
+		wantErr bool
+	}{
+		{name: "hex", pins: []string{hexPin}, decode: decodeHexPin, want: 1},
+		{name: "hex with colons", pins: []string{colonPin}, decode: decodeHexPin, want: 1},
+		{name: "base64", pins: []string{base64Pin}, decode: decodeBase64Pin, want: 1},
+		{name: "base64 with sha256 prefix", pins: []string{"sha256//" + base64Pin}, decode: decodeBase64Pin, want: 1},
+		{name: "blank pins are skipped", pins: []string{"", "  ", hexPin}, decode: decodeHexPin, want: 1},
+		{name: "no pins", pins: nil, decode: decodeHexPin, want: 0},
+		{name: "invalid hex", pins: []string{"not hex"}, decode: decodeHexPin, wantErr: true},
+		{name: "wrong length", pins: []string{hexPin[:40]}, decode: decodeHexPin, wantErr: true},
+		{name: "base64 pin as hex", pins: []string{base64Pin}, decode: decodeHexPin, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pins, err := parsePins(tt.pins, tt.decode)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePins(%q) succeeded, want error", tt.pins)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePins(%q) failed: %v", tt.pins, err)
+			}
+			if len(pins) != tt.want {
+				t.Fatalf("parsePins(%q) returned %d pins, want %d", tt.pins, len(pins), tt.want)
+			}
+			for _, pin := range pins {
+				if !bytes.Equal(pin, sum[:]) {
+					t.Errorf("parsePins(%q) = %x, want %x", tt.pins, pin, sum)
+				}
+			}
+		})
+	}
+}
+
+func splitPairs(s string) []string {
+	var pairs []string
+	for i := 0; i < len(s); i += 2 {
+		pairs = append(pairs, s[i:i+2])
+	}
+	return pairs
+}
+
+func TestVerifyPins(t *testing.T) {
+	cert := newTestCertificate(t)
+	certSum := sha256.Sum256(cert.Raw)
+	pubkeySum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	other := sha256.Sum256([]byte("other"))
+
+	tests := []struct {
+		name       string
+		certPins   [][]byte
+		pubkeyPins [][]byte
+		peers      []*x509.Certificate
+		wantErr    bool
+	}{
+		{name: "certificate pin", certPins: [][]byte{certSum[:]}, peers: []*x509.Certificate{cert}},
+		{name: "public key pin", pubkeyPins: [][]byte{pubkeySum[:]}, peers: []*x509.Certificate{cert}},
+		{name: "one of several pins", certPins: [][]byte{other[:], certSum[:]}, peers: []*x509.Certificate{cert}},
+		{name: "either kind of pin", certPins: [][]byte{other[:]}, pubkeyPins: [][]byte{pubkeySum[:]}, peers: []*x509.Certificate{cert}},
+		{name: "no matching pin", certPins: [][]byte{other[:]}, pubkeyPins: [][]byte{other[:]}, peers: []*x509.Certificate{cert}, wantErr: true},
+		{name: "certificate hash as public key pin", pubkeyPins: [][]byte{certSum[:]}, peers: []*x509.Certificate{cert}, wantErr: true},
+		{name: "no certificate", certPins: [][]byte{certSum[:]}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPins(tt.certPins, tt.pubkeyPins)(tls.ConnectionState{PeerCertificates: tt.peers})
+			if tt.wantErr && err == nil {
+				t.Fatal("verifyPins accepted the certificate, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("verifyPins rejected the certificate: %v", err)
+			}
+		})
+	}
+}
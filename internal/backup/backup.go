@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+)
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+const (
+	kindHost  = "host"
+	kindAlias = "alias"
+)
+
+var csvHeader = []string{"kind", "hostname", "domain", "type", "value", "enabled", "description", "uuid"}
+
+// Snapshot is an export of the Unbound host overrides of a firewall, with
+// every alias nested under the override it belongs to.
+type Snapshot struct {
+	Created       time.Time `json:"created" yaml:"created"`
+	HostOverrides []Host    `json:"host_overrides" yaml:"host_overrides"`
+}
+
+type Host struct {
+	UUID        string  `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Hostname    string  `json:"hostname" yaml:"hostname"`
+	Domain      string  `json:"domain" yaml:"domain"`
+	Type        string  `json:"type" yaml:"type"`
+	Value       string  `json:"value" yaml:"value"`
+	Enabled     string  `json:"enabled" yaml:"enabled"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Aliases     []Alias `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+type Alias struct {
+	UUID        string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Hostname    string `json:"hostname" yaml:"hostname"`
+	Domain      string `json:"domain" yaml:"domain"`
+	Enabled     string `json:"enabled" yaml:"enabled"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// New builds a snapshot from the overrides and aliases returned by the API.
+// Aliases whose parent override cannot be found are returned separately.
+func New(records []opnsense.HostOverride, aliases []opnsense.HostAlias) (Snapshot, []opnsense.HostAlias) {
+	snapshot := Snapshot{Created: time.Now().UTC(), HostOverrides: make([]Host, 0, len(records))}
+
+	byUUID := make(map[string]int, len(records))
+	byName := make(map[string]int, len(records))
+	for i, record := range records {
+		snapshot.HostOverrides = append(snapshot.HostOverrides, Host{
+			UUID:        record.UUID,
+			Hostname:    record.Hostname,
+			Domain:      record.Domain,
+			Type:        record.RecordType(),
+			Value:       record.Value(),
+			Enabled:     record.Enabled,
+			Description: record.Description,
+		})
+		byUUID[record.UUID] = i
+		name := strings.ToLower(record.Hostname + "." + record.Domain)
+		if _, exists := byName[name]; !exists {
+			byName[name] = i
+		}
+	}
+
+	var orphans []opnsense.HostAlias
+	for _, alias := range aliases {
+		i, ok := byUUID[alias.Host]
+		if !ok {
+			i, ok = byName[strings.ToLower(alias.Host)]
+		}
+		if !ok {
+			orphans = append(orphans, alias)
+			continue
+		}
+		snapshot.HostOverrides[i].Aliases = append(snapshot.HostOverrides[i].Aliases, Alias{
+			UUID:        alias.UUID,
+			Hostname:    alias.Hostname,
+			Domain:      alias.Domain,
+			Enabled:     alias.Enabled,
+			Description: alias.Description,
+		})
+	}
+
+	return snapshot, orphans
+}
+
+// FormatFromPath guesses the format of a snapshot file from its extension,
+// defaulting to JSON.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".csv":
+		return FormatCSV
+	default:
+		return FormatJSON
+	}
+}
+
+func Encode(w io.Writer, format string, snapshot Snapshot) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(snapshot); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case FormatCSV:
+		return encodeCSV(w, snapshot)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func Decode(r io.Reader, format string) (Snapshot, error) {
+	var snapshot Snapshot
+	var err error
+	switch format {
+	case FormatJSON:
+		err = json.NewDecoder(r).Decode(&snapshot)
+	case FormatYAML:
+		err = yaml.NewDecoder(r).Decode(&snapshot)
+	case FormatCSV:
+		snapshot, err = decodeCSV(r)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	for i := range snapshot.HostOverrides {
+		host := &snapshot.HostOverrides[i]
+		if host.Hostname == "" || host.Domain == "" {
+			return Snapshot{}, fmt.Errorf("host override %d: hostname and domain are required", i+1)
+		}
+		host.Type = strings.ToUpper(host.Type)
+		if host.Type == "" {
+			host.Type = opnsense.RecordTypeA
+		}
+		if !slices.Contains(opnsense.RecordTypes, host.Type) {
+			return Snapshot{}, fmt.Errorf("host override %d: unsupported record type %q (expected one of %s)", i+1, host.Type, strings.Join(opnsense.RecordTypes, ", "))
+		}
+	}
+
+	return snapshot, nil
+}
+
+// encodeCSV writes one row per override, each followed by the rows of its
+// aliases. Alias rows leave type and value empty.
+func encodeCSV(w io.Writer, snapshot Snapshot) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, host := range snapshot.HostOverrides {
+		if err := cw.Write([]string{kindHost, host.Hostname, host.Domain, host.Type, host.Value, host.Enabled, host.Description, host.UUID}); err != nil {
+			return err
+		}
+		for _, alias := range host.Aliases {
+			if err := cw.Write([]string{kindAlias, alias.Hostname, alias.Domain, "", "", alias.Enabled, alias.Description, alias.UUID}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func decodeCSV(r io.Reader) (Snapshot, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		return Snapshot{}, fmt.Errorf("expected CSV header %q", strings.Join(csvHeader, ","))
+	}
+
+	var snapshot Snapshot
+	for n, row := range rows[1:] {
+		switch row[0] {
+		case kindHost:
+			snapshot.HostOverrides = append(snapshot.HostOverrides, Host{
+				Hostname: row[1], Domain: row[2], Type: row[3], Value: row[4], Enabled: row[5], Description: row[6], UUID: row[7],
+			})
+		case kindAlias:
+			if len(snapshot.HostOverrides) == 0 {
+				return Snapshot{}, fmt.Errorf("line %d: alias without a preceding host row", n+2)
+			}
+			host := &snapshot.HostOverrides[len(snapshot.HostOverrides)-1]
+			host.Aliases = append(host.Aliases, Alias{
+				Hostname: row[1], Domain: row[2], Enabled: row[5], Description: row[6], UUID: row[7],
+			})
+		default:
+			return Snapshot{}, fmt.Errorf("line %d: unknown kind %q", n+2, row[0])
+		}
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	snapshot := Snapshot{
+		Created: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		HostOverrides: []Host{
+			{
+				UUID: "web", Hostname: "web", Domain: "home.lan", Type: "A", Value: "192.0.2.1", Enabled: "1",
+				Description: "Web server, \"primary\"",
+				Aliases: []Alias{
+					{UUID: "www", Hostname: "www", Domain: "home.lan", Enabled: "1", Description: "Website"},
+					{UUID: "blog", Hostname: "blog", Domain: "example.com", Enabled: "0"},
+				},
+			},
+			{UUID: "web6", Hostname: "web", Domain: "home.lan", Type: "AAAA", Value: "2001:db8::1", Enabled: "1"},
+			{UUID: "mx", Hostname: "home.lan", Domain: "home.lan", Type: "MX", Value: "10 mail.home.lan", Enabled: "1"},
+			{Hostname: "web", Domain: "home.lan", Type: "TXT", Value: "v=spf1 mx -all", Enabled: "1", Description: "line one\nline two"},
+		},
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, format, snapshot); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			got, err := Decode(&buf, format)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+
+			// CSV has no room for the creation time.
+			if format != FormatCSV && !got.Created.Equal(snapshot.Created) {
+				t.Errorf("created = %s, want %s", got.Created, snapshot.Created)
+			}
+			if !reflect.DeepEqual(got.HostOverrides, snapshot.HostOverrides) {
+				t.Errorf("host overrides = %+v, want %+v", got.HostOverrides, snapshot.HostOverrides)
+			}
+		})
+	}
+}
+
+func TestDecodeDefaults(t *testing.T) {
+	snapshot, err := Decode(strings.NewReader(`{"host_overrides":[{"hostname":"web","domain":"home.lan","value":"192.0.2.1"},{"hostname":"mail","domain":"home.lan","type":"mx","value":"10 mx.home.lan"}]}`), FormatJSON)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if got := []string{snapshot.HostOverrides[0].Type, snapshot.HostOverrides[1].Type}; !reflect.DeepEqual(got, []string{"A", "MX"}) {
+		t.Errorf("types = %v, want [A MX]", got)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{name: "invalid JSON", format: FormatJSON, input: `{"host_overrides":[`},
+		{name: "invalid YAML", format: FormatYAML, input: "host_overrides: [\n"},
+		{name: "missing hostname", format: FormatJSON, input: `{"host_overrides":[{"domain":"home.lan","value":"192.0.2.1"}]}`},
+		{name: "missing domain", format: FormatYAML, input: "host_overrides:\n  - hostname: web\n    value: 192.0.2.1\n"},
+		{name: "unknown record type", format: FormatJSON, input: `{"host_overrides":[{"hostname":"web","domain":"home.lan","type":"CNAME","value":"other.home.lan"}]}`},
+		{name: "unknown record type in CSV", format: FormatCSV, input: "kind,hostname,domain,type,value,enabled,description,uuid\nhost,web,home.lan,AAA,2001:db8::1,1,,\n"},
+		{name: "CSV without header", format: FormatCSV, input: "host,web,home.lan,A,192.0.2.1,1,,\n"},
+		{name: "empty CSV", format: FormatCSV, input: ""},
+		{name: "CSV alias without host", format: FormatCSV, input: "kind,hostname,domain,type,value,enabled,description,uuid\nalias,www,home.lan,,,1,,\n"},
+		{name: "CSV unknown kind", format: FormatCSV, input: "kind,hostname,domain,type,value,enabled,description,uuid\ncname,www,home.lan,,,1,,\n"},
+		{name: "CSV short row", format: FormatCSV, input: "kind,hostname,domain,type,value,enabled,description,uuid\nhost,web,home.lan\n"},
+		{name: "unsupported format", format: "xml", input: "<host_overrides/>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if snapshot, err := Decode(strings.NewReader(tt.input), tt.format); err == nil {
+				t.Errorf("Decode = %+v, want error", snapshot)
+			}
+		})
+	}
+}
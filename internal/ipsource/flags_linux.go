@@ -0,0 +1,42 @@
+//go:build linux
+
+package ipsource
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ipv6AddrFlags returns the kernel flags (IFA_F_*) of the IPv6 addresses of
+// the machine, keyed by address.
+func ipv6AddrFlags() (map[string]uint32, error) {
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	flags := make(map[string]uint32)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address, ifindex, prefix length, scope, flags, name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil || len(raw) != net.IPv6len {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags[net.IP(raw).String()] = uint32(value)
+	}
+	return flags, scanner.Err()
+}
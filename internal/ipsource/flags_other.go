@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ipsource
+
+// ipv6AddrFlags is only implemented on Linux; elsewhere no address is known
+// to be temporary.
+func ipv6AddrFlags() (map[string]uint32, error) {
+	return nil, nil
+}
@@ -0,0 +1,172 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+var DefaultHTTPURLs = []string{
+	"https://icanhazip.com",
+	"https://ifconfig.co/ip",
+	"https://ident.me",
+}
+
+type HTTP struct {
+	urls      []string
+	consensus int
+	clients   map[Family]*http.Client
+}
+
+func NewHTTP(urls []string, consensus int) (*HTTP, error) {
+	if len(urls) == 0 {
+		urls = DefaultHTTPURLs
+	}
+	if consensus <= 0 {
+		consensus = len(urls)/2 + 1
+	}
+	if consensus > len(urls) {
+		return nil, fmt.Errorf("ip_consensus %d exceeds the number of configured URLs (%d)", consensus, len(urls))
+	}
+
+	return &HTTP{
+		urls:      urls,
+		consensus: consensus,
+		clients: map[Family]*http.Client{
+			IPv4: newHTTPClient(IPv4),
+			IPv6: newHTTPClient(IPv6),
+		},
+	}, nil
+}
+
+func (h *HTTP) Name() string {
+	return KindHTTP
+}
+
+func (h *HTTP) Lookup(ctx context.Context, family Family) (net.IP, error) {
+	client := h.clients[family]
+
+	results := make([]net.IP, len(h.urls))
+	noFamily := make([]bool, len(h.urls))
+	var wg sync.WaitGroup
+	for i, url := range h.urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			ip, err := h.query(ctx, client, url, family)
+			if err != nil {
+				noFamily[i] = errors.Is(err, ErrNoAddress)
+				logger.Warn("IP echo service lookup failed", "url", url, "family", family, "err", err)
+				return
+			}
+			logger.Debug("IP echo service responded", "url", url, "family", family, "ip", ip)
+			results[i] = ip
+		}(i, url)
+	}
+	wg.Wait()
+
+	votes := make(map[string]int)
+	var best net.IP
+	for _, ip := range results {
+		if ip == nil {
+			continue
+		}
+		votes[ip.String()]++
+		if best == nil || votes[ip.String()] > votes[best.String()] {
+			best = ip
+		}
+	}
+
+	if best == nil && !slices.Contains(noFamily, false) {
+		// Every service was reached or unreachable for want of a route, so
+		// the machine has no address of the family rather than a flaky
+		// lookup.
+		return nil, fmt.Errorf("%w: no IP echo service returned an %s address", ErrNoAddress, family)
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no IP echo service returned an %s address", family)
+	}
+	if votes[best.String()] < h.consensus {
+		return nil, fmt.Errorf("no consensus on %s address: %d of %d services agreed on %s, need %d", family, votes[best.String()], len(h.urls), best, h.consensus)
+	}
+
+	return best, nil
+}
+
+// newHTTPClient returns a client connecting over family only. Lookups are
+// minutes apart, so connections are not kept alive between them.
+func newHTTPClient(family Family) *http.Client {
+	network := "tcp4"
+	if family == IPv6 {
+		network = "tcp6"
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSHandshakeTimeout: 5 * time.Second,
+			DisableKeepAlives:   true,
+		},
+	}
+}
+
+func (h *HTTP) query(ctx context.Context, client *http.Client, url string, family Family) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if noRoute(err) {
+			return nil, fmt.Errorf("%w: %v", ErrNoAddress, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("response is not an IP address: %q", strings.TrimSpace(string(body)))
+	}
+	if !family.matches(ip) {
+		return nil, fmt.Errorf("%w: response %s is not an %s address", ErrNoAddress, ip, family)
+	}
+
+	return ip, nil
+}
+
+// noRoute reports whether err shows that the service cannot be reached over
+// the address family at all: it has no address of the family, or the machine
+// has no address or route for it.
+func noRoute(err error) bool {
+	var addrErr *net.AddrError
+	if errors.As(err, &addrErr) && addrErr.Err == "no suitable address found" {
+		return true
+	}
+	return errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EADDRNOTAVAIL)
+}
@@ -0,0 +1,58 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPLookup(t *testing.T) {
+	echo := func(body string, status int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body + "\n"))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	tests := []struct {
+		name          string
+		family        Family
+		urls          []string
+		want          string
+		wantNoAddress bool
+		wantErr       bool
+	}{
+		{name: "consensus", family: IPv4, urls: []string{echo("192.0.2.1", 200), echo("192.0.2.1", 200), echo("192.0.2.2", 200)}, want: "192.0.2.1"},
+		{name: "no consensus", family: IPv4, urls: []string{echo("192.0.2.1", 200), echo("192.0.2.2", 200), echo("192.0.2.3", 200)}, wantErr: true},
+		// The test servers listen on 127.0.0.1, which cannot be dialed over
+		// IPv6, like the services seen from an IPv4-only host.
+		{name: "unreachable over family", family: IPv6, urls: []string{echo("2001:db8::1", 200), echo("2001:db8::1", 200)}, wantNoAddress: true},
+		{name: "wrong family", family: IPv4, urls: []string{echo("2001:db8::1", 200), echo("2001:db8::1", 200)}, wantNoAddress: true},
+		{name: "service error", family: IPv4, urls: []string{echo("", 500), echo("", 500)}, wantErr: true},
+		{name: "wrong family and service error", family: IPv4, urls: []string{echo("2001:db8::1", 200), echo("", 500)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewHTTP(tt.urls, 0)
+			if err != nil {
+				t.Fatalf("NewHTTP failed: %v", err)
+			}
+
+			ip, err := source.Lookup(context.Background(), tt.family)
+			if got := errors.Is(err, ErrNoAddress); got != tt.wantNoAddress {
+				t.Errorf("Lookup error = %v, want ErrNoAddress %v", err, tt.wantNoAddress)
+			}
+			if (err != nil) != (tt.wantErr || tt.wantNoAddress) {
+				t.Fatalf("Lookup = %v, %v, want error %v", ip, err, tt.wantErr || tt.wantNoAddress)
+			}
+			if err == nil && ip.String() != tt.want {
+				t.Errorf("Lookup = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+// Flags of IPv6 addresses that make them unfit to publish: RFC 4941 temporary
+// addresses rotate within hours, the others are about to go away or not usable.
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDADFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+
+	unstableFlags = ifaFlagTemporary | ifaFlagDADFailed | ifaFlagDeprecated | ifaFlagTentative
+)
+
+type Local struct {
+	iface   string
+	prefer  []*net.IPNet
+	exclude []*net.IPNet
+}
+
+func NewLocal(iface string, preferCIDR, excludeCIDR []string) (*Local, error) {
+	prefer, err := ParseCIDRs(preferCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefer_cidr: %v", err)
+	}
+	exclude, err := ParseCIDRs(excludeCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_cidr: %v", err)
+	}
+
+	return &Local{
+		iface:   iface,
+		prefer:  prefer,
+		exclude: exclude,
+	}, nil
+}
+
+func (l *Local) Name() string {
+	return KindLocal
+}
+
+func (l *Local) Lookup(ctx context.Context, family Family) (net.IP, error) {
+	if l.iface != "" || len(l.prefer) > 0 || len(l.exclude) > 0 {
+		ip, err := l.selectInterfaceIP(family)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("Selected interface IP", "family", family, "ip", ip)
+		return ip, nil
+	}
+
+	target := "1.1.1.1:80"
+	network := "udp4"
+	if family == IPv6 {
+		target = "[2606:4700:4700::1111]:80"
+		network = "udp6"
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create UDP connection: %v", ErrNoAddress, err)
+	}
+	defer conn.Close()
+
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if !ip.IsGlobalUnicast() {
+		return nil, fmt.Errorf("%w: local %s address %s is not a global unicast address", ErrNoAddress, family, ip)
+	}
+	if family == IPv6 {
+		ip = stableIPv6(ip)
+	}
+
+	logger.Debug("Fetched local IP", "family", family, "ip", ip)
+	return ip, nil
+}
+
+func (l *Local) selectInterfaceIP(family Family) (net.IP, error) {
+	var prefer []*net.IPNet
+	for _, network := range l.prefer {
+		if family.matches(network.IP) {
+			prefer = append(prefer, network)
+		}
+	}
+	// Without an interface, prefer_cidr is what selects the address, so a
+	// family it has no network for gets none rather than whatever global
+	// address comes first (a container bridge or a VPN tunnel).
+	if len(l.prefer) > 0 && len(prefer) == 0 && l.iface == "" {
+		return nil, fmt.Errorf("%w: prefer_cidr %v has no %s network, add one or set interface to select an address of this family", ErrFamilyNotSelected, l.prefer, family)
+	}
+
+	var interfaces []net.Interface
+	if l.iface != "" {
+		iface, err := net.InterfaceByName(l.iface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %q: %v", l.iface, err)
+		}
+		interfaces = []net.Interface{*iface}
+	} else {
+		var err error
+		interfaces, err = net.Interfaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list network interfaces: %v", err)
+		}
+	}
+
+	var candidates []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list addresses of interface %q: %v", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP
+			if !family.matches(ip) || !ip.IsGlobalUnicast() {
+				continue
+			}
+			if containsIP(l.exclude, ip) {
+				logger.Debug("Skipping excluded address", "interface", iface.Name, "ip", ip)
+				continue
+			}
+			candidates = append(candidates, ip)
+		}
+	}
+	if family == IPv6 {
+		candidates = preferStable(candidates)
+	}
+
+	if len(prefer) == 0 && len(candidates) > 0 {
+		return candidates[0], nil
+	}
+	for _, network := range prefer {
+		for _, ip := range candidates {
+			if network.Contains(ip) {
+				return ip, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no %s address found matching interface=%q prefer_cidr=%v exclude_cidr=%v", ErrNoAddress, family, l.iface, l.prefer, l.exclude)
+}
+
+// stableIPv6 returns a stable address of the interface of ip when ip, the
+// source address the kernel picked, is unstable (usually an RFC 4941
+// temporary address), preferring one in the same /64. Otherwise, or when the
+// interface has none, ip is returned.
+func stableIPv6(ip net.IP) net.IP {
+	flags, err := ipv6AddrFlags()
+	if err != nil {
+		logger.Debug("Failed to read IPv6 address flags", "err", err)
+		return ip
+	}
+	if flags[ip.String()]&unstableFlags == 0 {
+		return ip
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ip
+	}
+	prefix := net.CIDRMask(64, 128)
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var addresses []net.IP
+		owner := false
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				owner = owner || ipNet.IP.Equal(ip)
+				if IPv6.matches(ipNet.IP) && ipNet.IP.IsGlobalUnicast() {
+					addresses = append(addresses, ipNet.IP)
+				}
+			}
+		}
+		if !owner {
+			continue
+		}
+
+		var stable net.IP
+		for _, candidate := range addresses {
+			if flags[candidate.String()]&unstableFlags != 0 {
+				continue
+			}
+			if candidate.Mask(prefix).Equal(ip.Mask(prefix)) {
+				stable = candidate
+				break
+			}
+			if stable == nil {
+				stable = candidate
+			}
+		}
+		if stable != nil {
+			logger.Debug("Using stable IPv6 address instead of temporary source address", "source", ip, "ip", stable)
+			return stable
+		}
+		return ip
+	}
+
+	return ip
+}
+
+// preferStable moves unstable IPv6 addresses, such as RFC 4941 temporary
+// addresses, behind the stable ones, keeping the order otherwise.
+func preferStable(candidates []net.IP) []net.IP {
+	flags, err := ipv6AddrFlags()
+	if err != nil || len(flags) == 0 {
+		return candidates
+	}
+
+	var stable, unstable []net.IP
+	for _, ip := range candidates {
+		if flags[ip.String()]&unstableFlags != 0 {
+			unstable = append(unstable, ip)
+		} else {
+			stable = append(stable, ip)
+		}
+	}
+	return append(stable, unstable...)
+}
+
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HardwareAddr returns the MAC address of iface, or when iface is empty of the
+// interface that has ip assigned.
+func HardwareAddr(iface string, ip net.IP) (net.HardwareAddr, error) {
+	if iface != "" {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %q: %v", iface, err)
+		}
+		if len(i.HardwareAddr) == 0 {
+			return nil, fmt.Errorf("interface %q has no hardware address", iface)
+		}
+		return i.HardwareAddr, nil
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %v", err)
+	}
+	for _, i := range interfaces {
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) && len(i.HardwareAddr) > 0 {
+				return i.HardwareAddr, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no interface with a hardware address has %s assigned", ip)
+}
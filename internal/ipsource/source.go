@@ -0,0 +1,68 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrFamilyNotSelected is returned for an address family the configured
+// subnets do not select, so no address of that family is wanted.
+var ErrFamilyNotSelected = errors.New("address family not selected")
+
+// ErrNoAddress is returned when the machine has no address of the family, as
+// opposed to a lookup that failed and leaves it unknown.
+var ErrNoAddress = errors.New("no address")
+
+type Family int
+
+const (
+	IPv4 Family = iota
+	IPv6
+)
+
+func (f Family) String() string {
+	if f == IPv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+func (f Family) matches(ip net.IP) bool {
+	return (ip.To4() == nil) == (f == IPv6)
+}
+
+const (
+	KindLocal = "local"
+	KindHTTP  = "http"
+	KindSTUN  = "stun"
+)
+
+type Source interface {
+	Name() string
+	Lookup(ctx context.Context, family Family) (net.IP, error)
+}
+
+type Options struct {
+	Interface   string
+	PreferCIDR  []string
+	ExcludeCIDR []string
+	URLs        []string
+	Consensus   int
+	STUNServers []string
+}
+
+func New(kind string, opts Options) (Source, error) {
+	switch strings.ToLower(kind) {
+	case "", KindLocal:
+		return NewLocal(opts.Interface, opts.PreferCIDR, opts.ExcludeCIDR)
+	case KindHTTP:
+		return NewHTTP(opts.URLs, opts.Consensus)
+	case KindSTUN:
+		return NewSTUN(opts.STUNServers), nil
+	default:
+		return nil, fmt.Errorf("unknown IP source %q (expected %s, %s or %s)", kind, KindLocal, KindHTTP, KindSTUN)
+	}
+}
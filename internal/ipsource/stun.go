@@ -0,0 +1,197 @@
+package ipsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+const (
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunMagicCookie          = 0x2112A442
+	stunHeaderLength         = 20
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXORMappedAddress = 0x0020
+	stunFamilyIPv4           = 0x01
+	stunFamilyIPv6           = 0x02
+)
+
+var DefaultSTUNServers = []string{
+	"stun.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+type STUN struct {
+	servers []string
+}
+
+func NewSTUN(servers []string) *STUN {
+	if len(servers) == 0 {
+		servers = DefaultSTUNServers
+	}
+
+	return &STUN{
+		servers: servers,
+	}
+}
+
+func (s *STUN) Name() string {
+	return KindSTUN
+}
+
+func (s *STUN) Lookup(ctx context.Context, family Family) (net.IP, error) {
+	var lastErr error
+	for _, server := range s.servers {
+		ip, err := s.query(ctx, server, family)
+		if err != nil {
+			logger.Warn("STUN binding request failed", "server", server, "family", family, "err", err)
+			lastErr = err
+			continue
+		}
+		logger.Debug("STUN server responded", "server", server, "family", family, "ip", ip)
+		return ip, nil
+	}
+
+	return nil, fmt.Errorf("all STUN servers failed, last error: %v", lastErr)
+}
+
+func (s *STUN) query(ctx context.Context, server string, family Family) (net.IP, error) {
+	network := "udp4"
+	if family == IPv6 {
+		network = "udp6"
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %v", err)
+	}
+
+	request := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(request[2:4], 0)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return nil, fmt.Errorf("failed to generate transaction ID: %v", err)
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to send binding request: %v", err)
+	}
+
+	response := make([]byte, 1500)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binding response: %v", err)
+	}
+
+	ip, err := parseSTUNResponse(response[:n], request[8:20])
+	if err != nil {
+		return nil, err
+	}
+	if !family.matches(ip) {
+		return nil, fmt.Errorf("mapped address %s is not an %s address", ip, family)
+	}
+
+	return ip, nil
+}
+
+func parseSTUNResponse(msg, transactionID []byte) (net.IP, error) {
+	if len(msg) < stunHeaderLength {
+		return nil, fmt.Errorf("response too short: %d bytes", len(msg))
+	}
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingSuccess {
+		return nil, fmt.Errorf("unexpected message type 0x%04x", binary.BigEndian.Uint16(msg[0:2]))
+	}
+	if binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie {
+		return nil, fmt.Errorf("invalid magic cookie")
+	}
+	if !bytes.Equal(msg[8:20], transactionID) {
+		return nil, fmt.Errorf("transaction ID mismatch")
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if stunHeaderLength+length > len(msg) {
+		return nil, fmt.Errorf("truncated response")
+	}
+	attrs := msg[stunHeaderLength : stunHeaderLength+length]
+
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLength := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+attrLength > len(attrs) {
+			return nil, fmt.Errorf("truncated attribute 0x%04x", attrType)
+		}
+		value := attrs[4 : 4+attrLength]
+
+		switch attrType {
+		case stunAttrXORMappedAddress:
+			return decodeSTUNAddress(value, msg[4:20])
+		case stunAttrMappedAddress:
+			ip, err := decodeSTUNAddress(value, nil)
+			if err != nil {
+				return nil, err
+			}
+			mapped = ip
+		}
+
+		padded := (attrLength + 3) &^ 3
+		if 4+padded > len(attrs) {
+			break
+		}
+		attrs = attrs[4+padded:]
+	}
+
+	if mapped == nil {
+		return nil, fmt.Errorf("response contains no mapped address")
+	}
+	return mapped, nil
+}
+
+// decodeSTUNAddress decodes a (XOR-)MAPPED-ADDRESS value. For XOR-MAPPED-ADDRESS
+// the key is the magic cookie followed by the transaction ID.
+func decodeSTUNAddress(value, key []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("address attribute too short")
+	}
+
+	var size int
+	switch value[1] {
+	case stunFamilyIPv4:
+		size = net.IPv4len
+	case stunFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown address family 0x%02x", value[1])
+	}
+	if len(value) < 4+size {
+		return nil, fmt.Errorf("address attribute too short")
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,178 @@
+package ipsource
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// Transaction ID and attribute values of the sample responses in RFC 5769.
+var (
+	testTransactionID = []byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	testXORIPv4       = []byte{0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}
+	testXORIPv6       = []byte{
+		0x00, 0x02, 0xa1, 0x47,
+		0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79,
+		0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+	}
+	testMappedIPv4 = []byte{0x00, 0x01, 0x80, 0x55, 0xc6, 0x33, 0x64, 0x0a}
+)
+
+type stunAttr struct {
+	typ   uint16
+	value []byte
+}
+
+func stunMessage(msgType uint16, transactionID []byte, attrs ...stunAttr) []byte {
+	var body []byte
+	for _, attr := range attrs {
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint16(header[0:2], attr.typ)
+		binary.BigEndian.PutUint16(header[2:4], uint16(len(attr.value)))
+		body = append(body, header...)
+		body = append(body, attr.value...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	msg := make([]byte, stunHeaderLength, stunHeaderLength+len(body))
+	binary.BigEndian.PutUint16(msg[0:2], msgType)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(body)))
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], transactionID)
+	return append(msg, body...)
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	otherID := make([]byte, 12)
+	badCookie := stunMessage(stunBindingSuccess, testTransactionID, stunAttr{stunAttrXORMappedAddress, testXORIPv4})
+	binary.BigEndian.PutUint32(badCookie[4:8], 0)
+	truncated := stunMessage(stunBindingSuccess, testTransactionID, stunAttr{stunAttrXORMappedAddress, testXORIPv4})
+	truncated = truncated[:len(truncated)-2]
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "XOR-MAPPED-ADDRESS IPv4",
+			msg:  stunMessage(stunBindingSuccess, testTransactionID, stunAttr{stunAttrXORMappedAddress, testXORIPv4}),
+			want: "192.0.2.1",
+		},
+		{
+			name: "XOR-MAPPED-ADDRESS IPv6",
+			msg:  stunMessage(stunBindingSuccess, testTransactionID, stunAttr{stunAttrXORMappedAddress, testXORIPv6}),
+			want: "2001:db8:1234:5678:11:2233:4455:6677",
+		},
+		{
+			name: "MAPPED-ADDRESS",
+			msg:  stunMessage(stunBindingSuccess, testTransactionID, stunAttr{stunAttrMappedAddress, testMappedIPv4}),
+			want: "198.51.100.10",
+		},
+		{
+			name: "XOR-MAPPED-ADDRESS preferred over MAPPED-ADDRESS",
+			msg: stunMessage(stunBindingSuccess, testTransactionID,
+				stunAttr{stunAttrMappedAddress, testMappedIPv4},
+				stunAttr{stunAttrXORMappedAddress, testXORIPv4}),
+			want: "192.0.2.1",
+		},
+		{
+			name: "unknown attributes with padding are skipped",
+			msg: stunMessage(stunBindingSuccess, testTransactionID,
+				stunAttr{0x8022, []byte("test")},
+				stunAttr{0x8023, []byte{0x01}},
+				stunAttr{stunAttrXORMappedAddress, testXORIPv4}),
+			want: "192.0.2.1",
+		},
+		{
+			name:    "too short",
+			msg:     make([]byte, stunHeaderLength-1),
+			wantErr: true,
+		},
+		{
+			name:    "not a binding success",
+			msg:     stunMessage(stunBindingRequest, testTransactionID, stunAttr{stunAttrXORMappedAddress, testXORIPv4}),
+			wantErr: true,
+		},
+		{
+			name:    "invalid magic cookie",
+			msg:     badCookie,
+			wantErr: true,
+		},
+		{
+			name:    "transaction ID mismatch",
+			msg:     stunMessage(stunBindingSuccess, otherID, stunAttr{stunAttrXORMappedAddress, testXORIPv4}),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			msg:     truncated,
+			wantErr: true,
+		},
+		{
+			name:    "no mapped address",
+			msg:     stunMessage(stunBindingSuccess, testTransactionID, stunAttr{0x8022, []byte("test")}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := parseSTUNResponse(tt.msg, testTransactionID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSTUNResponse returned %s, want error", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSTUNResponse failed: %v", err)
+			}
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("parseSTUNResponse = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSTUNAddress(t *testing.T) {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+	copy(key[4:], testTransactionID)
+
+	tests := []struct {
+		name    string
+		value   []byte
+		key     []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "XOR IPv4", value: testXORIPv4, key: key, want: "192.0.2.1"},
+		{name: "XOR IPv6", value: testXORIPv6, key: key, want: "2001:db8:1234:5678:11:2233:4455:6677"},
+		{name: "plain IPv4", value: testMappedIPv4, want: "198.51.100.10"},
+		{name: "attribute too short", value: []byte{0x00, 0x01, 0x00}, wantErr: true},
+		{name: "address too short", value: testXORIPv6[:12], key: key, wantErr: true},
+		{name: "unknown family", value: []byte{0x00, 0x03, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := decodeSTUNAddress(tt.value, tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeSTUNAddress returned %s, want error", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeSTUNAddress failed: %v", err)
+			}
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("decodeSTUNAddress = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
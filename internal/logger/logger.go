@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"os"
 	"runtime"
 	"strings"
@@ -8,22 +9,32 @@ import (
 	"github.com/charmbracelet/log"
 )
 
-var globalLogger *log.Logger
+var (
+	globalLogger *log.Logger
+	output       io.Writer = os.Stdout
+)
 
 func Init(level log.Level) {
-	globalLogger = log.NewWithOptions(os.Stdout, log.Options{
+	globalLogger = log.NewWithOptions(output, log.Options{
 		Level: level,
 	})
 }
 
 func SetLevel(level log.Level) {
 	if globalLogger != nil {
-		globalLogger = log.NewWithOptions(os.Stdout, log.Options{
+		globalLogger = log.NewWithOptions(output, log.Options{
 			Level: level,
 		})
 	}
 }
 
+func SetOutput(w io.Writer) {
+	output = w
+	if globalLogger != nil {
+		globalLogger.SetOutput(w)
+	}
+}
+
 func Get() *log.Logger {
 	if globalLogger == nil {
 		Init(log.InfoLevel)
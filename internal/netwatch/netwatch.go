@@ -0,0 +1,5 @@
+package netwatch
+
+import "errors"
+
+var ErrUnsupported = errors.New("address change notifications are not supported on this platform")
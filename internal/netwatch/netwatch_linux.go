@@ -0,0 +1,123 @@
+//go:build linux
+
+package netwatch
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"opnsense-auto-dns/internal/logger"
+)
+
+const (
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// Watch subscribes to rtnetlink address events and signals on the returned
+// channel whenever an address is added to or removed from iface (or any
+// interface when iface is empty). Bursts of events are coalesced into a
+// single pending notification, and when the kernel drops events because the
+// socket buffer overflowed (ENOBUFS) a notification is sent as well, so the
+// caller resyncs. The subscription ends when ctx is cancelled.
+func Watch(ctx context.Context, iface string) (<-chan struct{}, error) {
+	index := 0
+	if iface != "" {
+		netIface, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %q: %v", iface, err)
+		}
+		index = netIface.Index
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netlink socket: %v", err)
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %v", err)
+	}
+
+	// A receive timeout lets the reader notice cancellation without relying
+	// on close(2) interrupting a blocked recvfrom.
+	timeout := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to set netlink socket timeout: %v", err)
+	}
+
+	logger.Debug("Subscribed to netlink address events", "interface", iface, "index", index)
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer syscall.Close(fd)
+		defer close(events)
+
+		buf := make([]byte, syscall.Getpagesize())
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				if errors.Is(err, syscall.ENOBUFS) {
+					logger.Debug("Netlink events were dropped, resyncing")
+					notify(events)
+					continue
+				}
+				logger.Error("Failed to read netlink message", "err", err)
+				return
+			}
+
+			if isAddressChange(buf[:n], index) {
+				notify(events)
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func notify(events chan<- struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
+
+func isAddressChange(data []byte, index int) bool {
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		logger.Warn("Failed to parse netlink message", "err", err)
+		return false
+	}
+
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWADDR && msg.Header.Type != syscall.RTM_DELADDR {
+			continue
+		}
+		if len(msg.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+
+		msgIndex := int(binary.NativeEndian.Uint32(msg.Data[4:8]))
+		if index != 0 && msgIndex != index {
+			continue
+		}
+
+		logger.Debug("Received netlink address event", "type", msg.Header.Type, "index", msgIndex)
+		return true
+	}
+
+	return false
+}
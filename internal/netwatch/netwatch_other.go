@@ -0,0 +1,9 @@
+//go:build !linux
+
+package netwatch
+
+import "context"
+
+func Watch(ctx context.Context, iface string) (<-chan struct{}, error) {
+	return nil, ErrUnsupported
+}
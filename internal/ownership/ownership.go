@@ -0,0 +1,171 @@
+package ownership
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	PolicyAdopt = "adopt"
+	PolicySkip  = "skip"
+	PolicyFail  = "fail"
+)
+
+// ErrNotOwned is wrapped by the errors returned for entries of another owner
+// under PolicyFail.
+var ErrNotOwned = errors.New("not owned by this agent")
+
+const (
+	marker       = "opnsense-auto-dns"
+	legacyPrefix = "Auto-updated by opnsense-auto-dns"
+	entriesField = "entries"
+)
+
+var tagPattern = regexp.MustCompile(`\[` + marker + `((?:\s+[a-z_]+=[^\s\]]*)*)\]`)
+
+// Tag is the machine-readable ownership marker embedded in the description of
+// the records an agent manages, e.g.
+// "[opnsense-auto-dns owner=web1 seen=2025-01-01T12:00:00Z]". Seen is the
+// agent's last heartbeat and is zero for tags written before heartbeats.
+type Tag struct {
+	Owner string
+	Seen  time.Time
+}
+
+func (t Tag) String() string {
+	if t.Seen.IsZero() {
+		return fmt.Sprintf("[%s owner=%s]", marker, t.Owner)
+	}
+	return fmt.Sprintf("[%s owner=%s seen=%s]", marker, t.Owner, t.Seen.UTC().Format(time.RFC3339))
+}
+
+// Expired reports whether the tag's heartbeat is older than lease. Tags
+// without a heartbeat never expire.
+func (t Tag) Expired(lease time.Duration, now time.Time) bool {
+	return !t.Seen.IsZero() && now.Sub(t.Seen) > lease
+}
+
+func Parse(description string) (Tag, bool) {
+	match := tagPattern.FindStringSubmatch(description)
+	if match == nil {
+		return Tag{}, false
+	}
+
+	var tag Tag
+	for _, field := range strings.Fields(match[1]) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "owner":
+			tag.Owner = value
+		case "seen":
+			if seen, err := time.Parse(time.RFC3339, value); err == nil {
+				tag.Seen = seen
+			}
+		}
+	}
+
+	return tag, tag.Owner != ""
+}
+
+// IsLegacy reports whether description was written by a release that predates
+// ownership tags. Such records are treated as owned by whichever agent manages
+// the hostname.
+func IsLegacy(description string) bool {
+	return strings.HasPrefix(description, legacyPrefix) && !tagPattern.MatchString(description)
+}
+
+func OwnedBy(description, owner string) bool {
+	if tag, ok := Parse(description); ok {
+		return tag.Owner == owner
+	}
+	return IsLegacy(description)
+}
+
+// AliasEntries returns the entries recorded by SetAliasEntries in the
+// description of a firewall alias, keyed by owner.
+func AliasEntries(description string) map[string][]string {
+	entries := make(map[string][]string)
+	for _, match := range tagPattern.FindAllStringSubmatch(description, -1) {
+		var owner, values string
+		for _, field := range strings.Fields(match[1]) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "owner":
+				owner = value
+			case entriesField:
+				values = value
+			}
+		}
+		if owner != "" && values != "" {
+			entries[owner] = strings.Split(values, ",")
+		}
+	}
+	return entries
+}
+
+// MaxAliasDescription is the longest firewall alias description
+// SetAliasEntries writes. Every agent sharing an alias adds a tag of about 80
+// characters, so this allows for a dozen agents.
+const MaxAliasDescription = 1024
+
+// SetAliasEntries records in the description of a firewall alias which of its
+// entries owner added, e.g. "Web servers [opnsense-auto-dns owner=web1
+// entries=192.0.2.10,2001:db8::10]", replacing the previous tag of owner.
+// Without entries the tag of owner is removed. It fails when the description
+// would grow beyond MaxAliasDescription.
+func SetAliasEntries(description, owner string, entries []string) (string, error) {
+	description = tagPattern.ReplaceAllStringFunc(description, func(tag string) string {
+		if t, ok := Parse(tag); ok && t.Owner == owner {
+			return ""
+		}
+		return tag
+	})
+	description = strings.Join(strings.Fields(description), " ")
+	if len(entries) == 0 {
+		return description, nil
+	}
+	description = strings.TrimSpace(fmt.Sprintf("%s [%s owner=%s %s=%s]", description, marker, owner, entriesField, strings.Join(entries, ",")))
+	if len(description) > MaxAliasDescription {
+		return "", fmt.Errorf("alias description would be %d characters long, more than the %d allowed; too many agents share the alias", len(description), MaxAliasDescription)
+	}
+	return description, nil
+}
+
+// TaggedBy reports whether description carries the ownership tag of owner.
+// Unlike OwnedBy it does not claim legacy records.
+func TaggedBy(description, owner string) bool {
+	tag, ok := Parse(description)
+	return ok && tag.Owner == owner
+}
+
+func Describe(owner string) string {
+	now := time.Now()
+	return fmt.Sprintf("%s at %s %s", legacyPrefix, now.Format("2006-01-02 15:04:05"), Tag{Owner: owner, Seen: now})
+}
+
+// Annotate appends the ownership tag of owner to a user-supplied description.
+func Annotate(description, owner string) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", description, Tag{Owner: owner}))
+}
+
+func ValidateOwner(owner string) error {
+	if owner == "" {
+		return fmt.Errorf("instance ID must not be empty")
+	}
+	if strings.ContainsAny(owner, " \t\r\n[]=") {
+		return fmt.Errorf("instance ID %q must not contain whitespace, brackets or '='", owner)
+	}
+	return nil
+}
+
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case PolicyAdopt, PolicySkip, PolicyFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q (expected %s, %s or %s)", policy, PolicyAdopt, PolicySkip, PolicyFail)
+	}
+}
@@ -0,0 +1,147 @@
+package ownership
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	seen := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		description string
+		want        Tag
+		wantOK      bool
+	}{
+		{
+			name:        "owner and heartbeat",
+			description: "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00 [opnsense-auto-dns owner=web1 seen=2025-01-01T12:00:00Z]",
+			want:        Tag{Owner: "web1", Seen: seen},
+			wantOK:      true,
+		},
+		{name: "owner only", description: "Mail server [opnsense-auto-dns owner=web1]", want: Tag{Owner: "web1"}, wantOK: true},
+		{name: "invalid heartbeat", description: "[opnsense-auto-dns owner=web1 seen=yesterday]", want: Tag{Owner: "web1"}, wantOK: true},
+		{name: "unknown fields", description: "[opnsense-auto-dns owner=web1 note=x]", want: Tag{Owner: "web1"}, wantOK: true},
+		{name: "empty owner", description: "[opnsense-auto-dns owner=]"},
+		{name: "no owner", description: "[opnsense-auto-dns seen=2025-01-01T12:00:00Z]"},
+		{name: "legacy", description: "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00"},
+		{name: "manual", description: "Printer"},
+		{name: "empty", description: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, ok := Parse(tt.description)
+			if ok != tt.wantOK || ok && (tag.Owner != tt.want.Owner || !tag.Seen.Equal(tt.want.Seen)) {
+				t.Errorf("Parse(%q) = %+v, %v, want %+v, %v", tt.description, tag, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantOwned   bool
+		wantTagged  bool
+	}{
+		{name: "own tag", description: "x [opnsense-auto-dns owner=web1]", wantOwned: true, wantTagged: true},
+		{name: "own tag with heartbeat", description: "x [opnsense-auto-dns owner=web1 seen=2025-01-01T12:00:00Z]", wantOwned: true, wantTagged: true},
+		{name: "other tag", description: "x [opnsense-auto-dns owner=web2]"},
+		{name: "legacy", description: "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00", wantOwned: true},
+		{name: "legacy prefix with other tag", description: "Auto-updated by opnsense-auto-dns at 2025-01-01 12:00:00 [opnsense-auto-dns owner=web2]"},
+		{name: "manual", description: "Printer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OwnedBy(tt.description, "web1"); got != tt.wantOwned {
+				t.Errorf("OwnedBy(%q) = %v, want %v", tt.description, got, tt.wantOwned)
+			}
+			if got := TaggedBy(tt.description, "web1"); got != tt.wantTagged {
+				t.Errorf("TaggedBy(%q) = %v, want %v", tt.description, got, tt.wantTagged)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		seen time.Time
+		want bool
+	}{
+		{name: "fresh", seen: now.Add(-time.Hour)},
+		{name: "at lease", seen: now.Add(-24 * time.Hour)},
+		{name: "expired", seen: now.Add(-25 * time.Hour), want: true},
+		{name: "no heartbeat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Tag{Owner: "web1", Seen: tt.seen}).Expired(24*time.Hour, now); got != tt.want {
+				t.Errorf("Expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantSeen    bool
+	}{
+		{name: "Describe", description: Describe("web1"), wantSeen: true},
+		{name: "String", description: Tag{Owner: "web1", Seen: time.Now()}.String(), wantSeen: true},
+		{name: "String without heartbeat", description: Tag{Owner: "web1"}.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, ok := Parse(tt.description)
+			if !ok || tag.Owner != "web1" || tag.Seen.IsZero() == tt.wantSeen {
+				t.Errorf("Parse(%q) = %+v, %v, want owner web1 (heartbeat %v)", tt.description, tag, ok, tt.wantSeen)
+			}
+		})
+	}
+}
+
+func TestSetAliasEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		owner       string
+		entries     []string
+		want        string
+		wantErr     bool
+	}{
+		{name: "added", description: "Web servers", owner: "web1", entries: []string{"192.0.2.1"}, want: "Web servers [opnsense-auto-dns owner=web1 entries=192.0.2.1]"},
+		{
+			name:        "replaced",
+			description: "Web servers [opnsense-auto-dns owner=web1 entries=192.0.2.1] [opnsense-auto-dns owner=web2 entries=192.0.2.2]",
+			owner:       "web1",
+			entries:     []string{"192.0.2.11", "2001:db8::11"},
+			want:        "Web servers [opnsense-auto-dns owner=web2 entries=192.0.2.2] [opnsense-auto-dns owner=web1 entries=192.0.2.11,2001:db8::11]",
+		},
+		{name: "removed", description: "Web servers [opnsense-auto-dns owner=web1 entries=192.0.2.1]", owner: "web1", want: "Web servers"},
+		{name: "too long", description: strings.Repeat("x", MaxAliasDescription-20), owner: "web1", entries: []string{"192.0.2.1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetAliasEntries(tt.description, tt.owner, tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetAliasEntries error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SetAliasEntries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package recordfile
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+)
+
+// ForwardsFile is a desired-state file of Unbound domain overrides, e.g.
+//
+//	forwards:
+//	  - domain: corp.example.com
+//	    server: 10.1.0.53
+//	  - domain: lab.example.com
+//	    server: 10.2.0.53
+//	    port: 853
+//	    type: dot
+//	    verify: dns.lab.example.com
+type ForwardsFile struct {
+	Forwards []Forward `json:"forwards" yaml:"forwards"`
+}
+
+// Forward is a desired domain override. A domain forwarded to several servers
+// has one entry per server.
+type Forward struct {
+	Domain      string `json:"domain" yaml:"domain"`
+	Server      string `json:"server" yaml:"server"`
+	Port        int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Verify      string `json:"verify,omitempty" yaml:"verify,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+}
+
+func (f Forward) IsEnabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+// PortValue returns the port as sent to the API, empty for the default port.
+func (f Forward) PortValue() string {
+	if f.Port == 0 {
+		return ""
+	}
+	return strconv.Itoa(f.Port)
+}
+
+// LoadForwards reads and validates a forwards file. Files ending in .json are
+// parsed as JSON, anything else as YAML.
+func LoadForwards(path string) ([]Forward, error) {
+	var file ForwardsFile
+	if err := decode(path, "forwards", &file); err != nil {
+		return nil, err
+	}
+
+	if err := PrepareForwards(file.Forwards); err != nil {
+		return nil, err
+	}
+	return file.Forwards, nil
+}
+
+// PrepareForwards fills in the default type (forward) of forwards and
+// validates them.
+func PrepareForwards(forwards []Forward) error {
+	type key struct{ domain, server string }
+	seen := make(map[key]int, len(forwards))
+
+	for i := range forwards {
+		forward := &forwards[i]
+		forward.Domain = strings.TrimSuffix(forward.Domain, ".")
+		if forward.Type == "" {
+			forward.Type = opnsense.ForwardTypeForward
+		}
+		forward.Type = strings.ToLower(forward.Type)
+
+		if err := validateForward(*forward); err != nil {
+			return fmt.Errorf("forward %d (%s): %v", i+1, forward.Domain, err)
+		}
+
+		k := key{strings.ToLower(forward.Domain), forward.Server}
+		if first, ok := seen[k]; ok {
+			return fmt.Errorf("forward %d (%s): duplicate of forward %d", i+1, forward.Domain, first)
+		}
+		seen[k] = i + 1
+	}
+
+	return nil
+}
+
+func validateForward(forward Forward) error {
+	if forward.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+	if net.ParseIP(forward.Server) == nil {
+		return fmt.Errorf("server %q is not an IP address", forward.Server)
+	}
+	if forward.Port < 0 || forward.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", forward.Port)
+	}
+	if forward.Type != opnsense.ForwardTypeForward && forward.Type != opnsense.ForwardTypeDoT {
+		return fmt.Errorf("unsupported type %q (expected %s or %s)", forward.Type, opnsense.ForwardTypeForward, opnsense.ForwardTypeDoT)
+	}
+	if forward.Verify != "" && forward.Type != opnsense.ForwardTypeDoT {
+		return fmt.Errorf("verify is only supported for type %s", opnsense.ForwardTypeDoT)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package recordfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+)
+
+const defaultMXPriority = 10
+
+// File is a desired-state records file, e.g.
+//
+//	domain: home.local
+//	records:
+//	  - hostname: nas
+//	    type: A
+//	    value: 192.168.1.20
+//
+// Domain is the default for records that do not set their own.
+type File struct {
+	Domain  string   `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Records []Record `json:"records" yaml:"records"`
+}
+
+// Record is a desired host override. Value is the address for A and AAAA, the
+// mail server for MX (with Priority, default 10 when not given) and the text
+// for TXT.
+type Record struct {
+	Hostname    string `json:"hostname" yaml:"hostname"`
+	Domain      string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Value       string `json:"value" yaml:"value"`
+	Priority    *int   `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+}
+
+func (r Record) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// RecordValue returns the value in the notation of opnsense.HostOverride.Value.
+func (r Record) RecordValue() string {
+	if r.Type == opnsense.RecordTypeMX && r.Priority != nil {
+		return fmt.Sprintf("%d %s", *r.Priority, r.Value)
+	}
+	return r.Value
+}
+
+// Load reads and validates a records file. Files ending in .json are parsed as
+// JSON, anything else as YAML.
+func Load(path string) ([]Record, error) {
+	var file File
+	if err := decode(path, "records", &file); err != nil {
+		return nil, err
+	}
+
+	if err := Prepare(file.Records, file.Domain); err != nil {
+		return nil, err
+	}
+	return file.Records, nil
+}
+
+func decode(path, kind string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s file %s: %v", kind, path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, v)
+	} else {
+		err = yaml.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing %s file %s: %v", kind, path, err)
+	}
+	return nil
+}
+
+// Prepare fills in the defaults of records (domain, type A, MX priority 10)
+// and validates them.
+func Prepare(records []Record, domain string) error {
+	seen := make(map[opnsense.RecordKey]int, len(records))
+	for i := range records {
+		record := &records[i]
+		if record.Domain == "" {
+			record.Domain = domain
+		}
+		if record.Type == "" {
+			record.Type = opnsense.RecordTypeA
+		}
+		record.Type = strings.ToUpper(record.Type)
+		if record.Type == opnsense.RecordTypeMX && record.Priority == nil {
+			priority := defaultMXPriority
+			record.Priority = &priority
+		}
+
+		if err := validate(*record); err != nil {
+			return fmt.Errorf("record %d (%s.%s): %v", i+1, record.Hostname, record.Domain, err)
+		}
+
+		key := opnsense.NewRecordKey(record.Hostname, record.Domain, record.Type)
+		if first, ok := seen[key]; ok {
+			return fmt.Errorf("record %d (%s.%s): duplicate of record %d", i+1, record.Hostname, record.Domain, first)
+		}
+		seen[key] = i + 1
+	}
+
+	return nil
+}
+
+func validate(record Record) error {
+	if record.Hostname == "" {
+		return fmt.Errorf("hostname is required")
+	}
+	if record.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+
+	ip := net.ParseIP(record.Value)
+	switch record.Type {
+	case opnsense.RecordTypeA:
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("value %q is not an IPv4 address", record.Value)
+		}
+	case opnsense.RecordTypeAAAA:
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("value %q is not an IPv6 address", record.Value)
+		}
+	case opnsense.RecordTypeMX:
+		if record.Value == "" || strings.ContainsAny(record.Value, " \t") {
+			return fmt.Errorf("value %q is not a mail server host name", record.Value)
+		}
+		if *record.Priority < 0 || *record.Priority > 65535 {
+			return fmt.Errorf("priority %d is out of range", *record.Priority)
+		}
+	case opnsense.RecordTypeTXT:
+		if record.Value == "" {
+			return fmt.Errorf("value is required")
+		}
+	default:
+		return fmt.Errorf("unsupported record type %q", record.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package recordfile
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"opnsense-auto-dns/internal/api/opnsense"
+)
+
+func TestPrepareMXPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", record: `{"hostname": "home.lan", "type": "mx", "value": "mail.home.lan"}`, want: "10 mail.home.lan"},
+		{name: "zero", record: `{"hostname": "home.lan", "type": "MX", "value": "mail.home.lan", "priority": 0}`, want: "0 mail.home.lan"},
+		{name: "given", record: `{"hostname": "home.lan", "type": "MX", "value": "mail.home.lan", "priority": 20}`, want: "20 mail.home.lan"},
+		{name: "out of range", record: `{"hostname": "home.lan", "type": "MX", "value": "mail.home.lan", "priority": 70000}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file File
+			if err := yaml.Unmarshal([]byte(`records: [`+tt.record+`]`), &file); err != nil {
+				t.Fatalf("invalid test record: %v", err)
+			}
+
+			err := Prepare(file.Records, "home.lan")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			record := file.Records[0]
+			if got := record.RecordValue(); got != tt.want {
+				t.Errorf("RecordValue = %q, want %q", got, tt.want)
+			}
+
+			// The value written for the record reads back unchanged, so a
+			// sync finds nothing to update.
+			override := opnsense.NewDNSRecord(record.Hostname, record.Domain, record.Type, record.RecordValue())
+			if got := override.Value(); got != tt.want {
+				t.Errorf("host override value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}